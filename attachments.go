@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// attachmentDownloader copies attachments off Discord's CDN before their
+// signed URLs expire. Files land in dir; maxBytes (0 = unlimited) caps each
+// one, checked against the size Discord reports and again while reading.
+type attachmentDownloader struct {
+	httpClient  *http.Client
+	dir         string
+	maxBytes    int64
+	concurrency int
+}
+
+// attachmentFile is the outcome of one download: where the copy lives
+// (relative to the export files), its digest and length, or why it failed.
+type attachmentFile struct {
+	localPath string
+	sha256    string
+	bytes     int64
+	err       error
+}
+
+// downloadSummary tallies a run's downloads for the closing report.
+type downloadSummary struct {
+	dir    string
+	saved  int
+	failed int
+	bytes  int64
+}
+
+// saveAttachments downloads the export's attachments when the run asked for
+// it and reports how that went. Problems are warnings: the export itself is
+// still written, with download_error set on attachments that were missed.
+// Interrupted runs skip downloading so the partial export is written at once.
+func saveAttachments(ctx context.Context, export *Export, cfg *runConfig) {
+	if !cfg.DownloadAttachments {
+		return
+	}
+	if ctx.Err() != nil {
+		if !cfg.Quiet {
+			fmt.Println("interrupted; skipping attachment downloads")
+		}
+		return
+	}
+	summary, err := downloadAttachments(ctx, export, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "warning: attachment download failed:", err)
+		return
+	}
+	if summary.failed > 0 {
+		fmt.Fprintf(os.Stderr, "warning: %d attachments could not be downloaded (see download_error in the export)\n", summary.failed)
+	}
+	if summary.saved > 0 && !cfg.Quiet {
+		fmt.Printf("downloaded %d attachments (%s) to %s\n", summary.saved, formatSize(summary.bytes), summary.dir)
+	}
+}
+
+// downloadAttachments saves every attachment in the export into
+// <prefix>_files/ and wraps the export's sources so each Attachment read
+// afterwards carries its local path and SHA-256. Individual failures are
+// recorded on the attachment rather than failing the run.
+func downloadAttachments(ctx context.Context, export *Export, cfg *runConfig) (downloadSummary, error) {
+	var jobs []Attachment
+	seen := make(map[string]struct{})
+	err := forEachMessage(export, func(_ *ChannelExport, msg *Message) error {
+		for i := range msg.Attachments {
+			att := msg.Attachments[i]
+			if _, dup := seen[att.ID]; dup || att.URL == "" {
+				continue
+			}
+			seen[att.ID] = struct{}{}
+			jobs = append(jobs, att)
+		}
+		return nil
+	})
+	if err != nil || len(jobs) == 0 {
+		return downloadSummary{}, err
+	}
+
+	d := &attachmentDownloader{
+		httpClient:  &http.Client{Timeout: attachmentTimeout},
+		dir:         stripExportExtension(cfg.OutputPrefix) + attachmentDirSuffix,
+		maxBytes:    cfg.MaxAttachmentBytes,
+		concurrency: cfg.Concurrency,
+	}
+	if err := os.MkdirAll(d.dir, 0o750); err != nil {
+		return downloadSummary{}, err
+	}
+	results := d.fetchAll(ctx, jobs)
+
+	summary := downloadSummary{dir: d.dir}
+	for _, res := range results {
+		if res.err != nil {
+			summary.failed++
+			continue
+		}
+		summary.saved++
+		summary.bytes += res.bytes
+	}
+	annotateExport(export, func(msg *Message) {
+		for i := range msg.Attachments {
+			if res, ok := results[msg.Attachments[i].ID]; ok {
+				res.apply(&msg.Attachments[i])
+			}
+		}
+	})
+	return summary, nil
+}
+
+// fetchAll downloads jobs with at most d.concurrency requests in flight.
+func (d *attachmentDownloader) fetchAll(ctx context.Context, jobs []Attachment) map[string]attachmentFile {
+	queue := make(chan *Attachment)
+	results := make(map[string]attachmentFile, len(jobs))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for range min(d.concurrency, len(jobs)) {
+		wg.Go(func() {
+			for att := range queue {
+				res := d.fetch(ctx, att)
+				mu.Lock()
+				results[att.ID] = res
+				mu.Unlock()
+			}
+		})
+	}
+	for i := range jobs {
+		queue <- &jobs[i]
+	}
+	close(queue)
+	wg.Wait()
+	return results
+}
+
+// fetch streams one attachment into a temp file while hashing it, renaming
+// it into place only once it is complete and within the size limit.
+func (d *attachmentDownloader) fetch(ctx context.Context, att *Attachment) attachmentFile {
+	if d.maxBytes > 0 && att.Size > d.maxBytes {
+		return attachmentFile{err: fmt.Errorf("size %d exceeds limit of %d bytes", att.Size, d.maxBytes)}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, att.URL, http.NoBody)
+	if err != nil {
+		return attachmentFile{err: err}
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return attachmentFile{err: err}
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return attachmentFile{err: fmt.Errorf("http %d", resp.StatusCode)}
+	}
+	if d.maxBytes > 0 && resp.ContentLength > d.maxBytes {
+		return attachmentFile{err: fmt.Errorf("size %d exceeds limit of %d bytes", resp.ContentLength, d.maxBytes)}
+	}
+
+	tmp, err := os.CreateTemp(d.dir, ".download-*")
+	if err != nil {
+		return attachmentFile{err: err}
+	}
+	body := io.Reader(resp.Body)
+	if d.maxBytes > 0 {
+		body = io.LimitReader(resp.Body, d.maxBytes+1)
+	}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && d.maxBytes > 0 && n > d.maxBytes {
+		err = fmt.Errorf("body exceeds limit of %d bytes", d.maxBytes)
+	}
+	name := attachmentFileName(att)
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(d.dir, name))
+	}
+	if err != nil {
+		return attachmentFile{err: errors.Join(err, os.Remove(tmp.Name()))}
+	}
+	return attachmentFile{
+		localPath: filepath.ToSlash(filepath.Join(filepath.Base(d.dir), name)),
+		sha256:    hex.EncodeToString(hash.Sum(nil)),
+		bytes:     n,
+	}
+}
+
+func (res *attachmentFile) apply(att *Attachment) {
+	if res.err != nil {
+		att.DownloadError = res.err.Error()
+		return
+	}
+	att.LocalPath = res.localPath
+	att.SHA256 = res.sha256
+	att.DownloadedBytes = res.bytes
+}
+
+// attachmentFileName prefixes the attachment ID so identically named uploads
+// never collide, and reduces the uploader's filename to characters that are
+// safe on every filesystem and in Markdown links.
+func attachmentFileName(att *Attachment) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, filepath.Base(att.Filename))
+	name = strings.TrimLeft(name, ".")
+	if len(name) > maxAttachmentNameLen {
+		name = name[len(name)-maxAttachmentNameLen:]
+	}
+	if name == "" {
+		return att.ID
+	}
+	return att.ID + "_" + name
+}
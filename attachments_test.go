@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadAttachments(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/drop.bin":
+			_, _ = w.Write([]byte("abcd"))
+		case "/big.bin":
+			_, _ = w.Write(make([]byte, 64))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	prefix := filepath.Join(t.TempDir(), "out")
+	export := &Export{
+		ChannelID: "100",
+		Messages: []Message{
+			{ID: "1", Attachments: []Attachment{
+				{ID: "a1", Filename: "../drop me.bin", URL: srv.URL + "/drop.bin", Size: 4},
+				{ID: "a2", Filename: "gone.txt", URL: srv.URL + "/gone.txt", Size: 4},
+			}},
+			{ID: "2", Attachments: []Attachment{
+				// Discord understated the size, so only the body check stops it.
+				{ID: "a3", Filename: "big.bin", URL: srv.URL + "/big.bin", Size: 8},
+				{ID: "a4", Filename: "huge.iso", URL: srv.URL + "/huge.iso", Size: 1 << 30},
+			}},
+		},
+	}
+	cfg := &runConfig{OutputPrefix: prefix + ".json", MaxAttachmentBytes: 32, Concurrency: 2}
+
+	summary, err := downloadAttachments(context.Background(), export, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.saved != 1 || summary.failed != 3 || summary.bytes != 4 {
+		t.Errorf("summary = %d saved (%d bytes), %d failed; want 1 (4), 3", summary.saved, summary.bytes, summary.failed)
+	}
+
+	got := make(map[string]Attachment)
+	if err := forEachMessage(export, func(_ *ChannelExport, msg *Message) error {
+		for _, att := range msg.Attachments {
+			got[att.ID] = att
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := got["a1"]
+	if saved.LocalPath != "out_files/a1_drop_me.bin" || saved.DownloadedBytes != 4 || saved.DownloadError != "" {
+		t.Errorf("a1 = %+v, want it saved as out_files/a1_drop_me.bin", saved)
+	}
+	// sha256("abcd")
+	if saved.SHA256 != "88d4266fd4e6338d13b845fcf289579d209c897823b9217da3e161936f031589" {
+		t.Errorf("a1 sha256 = %s", saved.SHA256)
+	}
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(prefix), filepath.FromSlash(saved.LocalPath)))
+	if err != nil || string(data) != "abcd" {
+		t.Errorf("saved file = %q, %v; want abcd", data, err)
+	}
+	for _, id := range []string{"a2", "a3", "a4"} {
+		if att := got[id]; att.DownloadError == "" || att.LocalPath != "" {
+			t.Errorf("%s = %+v, want a download error and no local copy", id, att)
+		}
+	}
+
+	entries, err := os.ReadDir(prefix + attachmentDirSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("attachment dir holds %d entries, want only the saved file", len(entries))
+	}
+}
+
+func TestAttachmentFileName(t *testing.T) {
+	tests := []struct {
+		att  Attachment
+		want string
+	}{
+		{Attachment{ID: "1", Filename: "report.pdf"}, "1_report.pdf"},
+		{Attachment{ID: "2", Filename: "my file (1).png"}, "2_my_file__1_.png"},
+		{Attachment{ID: "3", Filename: "../../etc/passwd"}, "3_passwd"},
+		{Attachment{ID: "4", Filename: ".hidden"}, "4_hidden"},
+		{Attachment{ID: "5", Filename: ""}, "5"},
+	}
+	for _, tt := range tests {
+		if got := attachmentFileName(&tt.att); got != tt.want {
+			t.Errorf("attachmentFileName(%q) = %q, want %q", tt.att.Filename, got, tt.want)
+		}
+	}
+}
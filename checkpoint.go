@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Checkpoint is the on-disk snapshot of an in-progress channel scrape. It
+// holds everything ScrapeChannel needs to continue paginating: the last
+// "before" cursor, the stats so far and where the messages already collected
+// sit in the spool file next to the checkpoint.
+type Checkpoint struct {
+	ChannelID    string         `json:"channel_id"`
+	Before       string         `json:"before"`
+	SavedAt      time.Time      `json:"saved_at"`
+	Filters      FilterSummary  `json:"filters"`
+	Stats        Stats          `json:"stats"`
+	MessageCount int            `json:"message_count"`
+	Segments     []spoolSegment `json:"segments"`
+}
+
+func checkpointPath(prefix string) string {
+	return stripExportExtension(prefix) + checkpointSuffix
+}
+
+// checkpointSpoolPath is the spool a checkpointed scrape appends to.
+func checkpointSpoolPath(path string) string {
+	return checkpointPrefix(path) + spoolSuffix
+}
+
+// openCheckpointSpool opens the spool for a checkpointed scrape, restoring the
+// stream recorded in cp when resuming. Pages written after the checkpoint
+// was saved are dropped; they are fetched again from cp.Before.
+func openCheckpointSpool(path string, cp *Checkpoint) (*spool, *spoolStream, error) {
+	if cp == nil {
+		sp, err := openSpool(checkpointSpoolPath(path), 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		return sp, sp.newStream(), nil
+	}
+
+	stream := &spoolStream{segments: cp.Segments, count: cp.MessageCount}
+	sp, err := openSpool(checkpointSpoolPath(path), stream.end())
+	if err != nil {
+		return nil, nil, err
+	}
+	return sp, sp.restoreStream(cp.Segments, cp.MessageCount), nil
+}
+
+// checkpointPrefix recovers the output prefix a checkpoint was written for.
+func checkpointPrefix(path string) string {
+	return strings.TrimSuffix(path, checkpointSuffix)
+}
+
+func loadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if cp.ChannelID == "" {
+		return nil, fmt.Errorf("%s has no channel_id", path)
+	}
+	return &cp, nil
+}
+
+// saveCheckpoint writes the checkpoint via a temp file and rename so a crash
+// mid-write never leaves a truncated checkpoint behind.
+func saveCheckpoint(path string, cp *Checkpoint) error {
+	cp.SavedAt = time.Now().UTC()
+	tmp := path + ".tmp"
+	if err := writeJSON(tmp, cp); err != nil {
+		return err
+	}
+	return os.Rename(filepath.Clean(tmp), filepath.Clean(path))
+}
+
+func removeCheckpoint(path string) error {
+	if err := os.Remove(filepath.Clean(path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// checkpointScrape persists progress for opts when checkpointing is enabled,
+// warning (not failing) if the write itself goes wrong.
+func checkpointScrape(opts *scrapeOptions, before string, stats Stats, out *spoolStream) {
+	if opts.CheckpointPath == "" || before == "" {
+		return
+	}
+	cp := Checkpoint{
+		ChannelID:    opts.ChannelID,
+		Before:       before,
+		Filters:      newFilterSummary(opts),
+		Stats:        stats,
+		MessageCount: out.count,
+		Segments:     out.segments,
+	}
+	if err := saveCheckpoint(opts.CheckpointPath, &cp); err != nil {
+		fmt.Fprintln(os.Stderr, "warning: failed to write checkpoint:", err)
+	}
+}
+
+// resumeConfig rebuilds a run from a checkpoint. The channel and filters come
+// from the checkpoint so the resumed pages match the ones already collected;
+// only token, format, output and quiet are taken from the command line.
+func resumeConfig(path, token, format, output string, quiet bool) (*runConfig, error) {
+	cp, err := loadCheckpoint(path)
+	if err != nil {
+		return nil, fmt.Errorf("load checkpoint: %w", err)
+	}
+
+	prefix := strings.TrimSpace(output)
+	if prefix == "" {
+		prefix = checkpointPrefix(path)
+	}
+
+	cfg := &runConfig{
+		Token:        token,
+		OutputPrefix: prefix,
+		Format:       format,
+		Quiet:        quiet,
+		Options: scrapeOptions{
+			ChannelID:      cp.ChannelID,
+			MaxMessages:    cp.Filters.Limit,
+			Since:          cp.Filters.Since,
+			Until:          cp.Filters.Until,
+			Quiet:          quiet,
+			CheckpointPath: path,
+			Resume:         cp,
+		},
+	}
+	applyContentFilters(&cfg.Options, &cp.Filters)
+	if cfg.Options.filter, err = compileFilter(&cfg.Options); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/ed25519"
 	"errors"
 	"flag"
 	"fmt"
@@ -17,17 +18,54 @@ type runConfig struct {
 	OutputPrefix string
 	Format       string
 	Quiet        bool
-	Options      scrapeOptions
+	// NDJSONMeta adds header/trailer lines around NDJSON messages.
+	NDJSONMeta bool
+	// Columns picks and orders CSV/TSV columns; empty means all.
+	Columns     []string
+	Split       bool
+	Concurrency int
+	// DownloadAttachments saves attachment files next to the export;
+	// MaxAttachmentBytes (0 = unlimited) skips anything larger.
+	DownloadAttachments bool
+	MaxAttachmentBytes  int64
+	// ExtractIndicators attaches IOCs to messages and the export;
+	// IndicatorsFile ("json" or "csv") also writes them on their own.
+	ExtractIndicators bool
+	IndicatorsFile    string
+	// SigningKey, loaded for --sign, writes a detached <file>.sig next to
+	// every output and the manifest.
+	SigningKey ed25519.PrivateKey
+	// ChannelIDs holds every --channel value; single-channel runs also set
+	// Options.ChannelID.
+	ChannelIDs []string
+	Options    scrapeOptions
 }
 
 type scrapeOptions struct {
-	ChannelID   string
-	Keywords    []string
-	Users       []string
-	MaxMessages int
-	Since       *time.Time
-	Until       *time.Time
-	Quiet       bool
+	GuildID         string
+	ChannelID       string
+	Keywords        []string
+	Users           []string
+	Query           string
+	Regexes         []string
+	ExcludeKeywords []string
+	ExcludeUsers    []string
+	Bots            string
+	Types           []string
+	MaxMessages     int
+	Since           *time.Time
+	Until           *time.Time
+	Threads         bool
+	Quiet           bool
+
+	// filter is compiled from the content filters above by parseConfig (or
+	// whoever builds the options) and shared by every scrape in the run.
+	filter messageFilter
+
+	// CheckpointPath enables periodic checkpoints for single-channel
+	// scrapes; Resume seeds pagination from a previously saved one.
+	CheckpointPath string
+	Resume         *Checkpoint
 }
 
 func (m *multiValue) String() string {
@@ -49,19 +87,42 @@ func parseConfig() (*runConfig, error) {
 	}
 
 	token := flag.String("token", "", "Discord bot/user token (or set DISCORD_TOKEN)")
-	channel := flag.String("channel", "", "Channel ID to scrape (required)")
+	var channels multiValue
+	flag.Var(&channels, "channel", "Channel ID to scrape (repeatable or comma-separated; required unless --guild)")
+	guild := flag.String("guild", "", "Guild ID to sweep every readable text channel")
+	split := flag.Bool("split", false, "With several channels or --guild, write one file per channel plus an index manifest")
+	concurrency := flag.Int("concurrency", defaultConcurrency, "Channels scraped (and attachments downloaded) in parallel")
 	daysBack := flag.Int("days", 0, "Relative days window (required if --hours absent)")
 	hoursBack := flag.Int("hours", 0, "Relative hours window (required if --days absent)")
 	rangeStr := flag.String("range", "", "Absolute window start,end (RFC3339)")
 	maxMessages := flag.Int("max", 0, "Stop after collecting this many messages (0 = unlimited)")
 	var users multiValue
 	flag.Var(&users, "user", "Filter by username or ID (repeatable)")
-	format := flag.String("format", "json", "Output format: json, markdown, or both")
-	output := flag.String("output", "", "Output filename prefix (default discord_<channel>_<timestamp>)")
+	format := flag.String("format", "json", "Output format: json, markdown, both, ndjson, csv, tsv, html, sqlite, stix, or misp")
+	output := flag.String("output", "", "Output filename prefix (default discord_<channel>_<timestamp>; - streams ndjson to stdout)")
+	var columns multiValue
+	flag.Var(&columns, "columns", "CSV/TSV columns to write, in order (repeatable or comma-separated; default all)")
+	ndjsonMeta := flag.Bool("ndjson-meta", true, "Wrap NDJSON messages in header/trailer lines with filters and stats")
 	quiet := flag.Bool("quiet", false, "Only print errors")
+	threads := flag.Bool("threads", false, "Also scrape active and archived threads and forum posts")
+	resume := flag.String("resume", "", "Resume a single-channel scrape from a checkpoint file")
+	download := flag.Bool("download-attachments", false, "Save attachments under <prefix>_files/ with their SHA-256")
+	extractIndicators := flag.Bool("extract-indicators", false, "Extract URLs, domains, IPs, hashes, CVEs, emails and crypto addresses")
+	indicatorsFile := flag.String("indicators-file", "", "Also write extracted indicators to <prefix>_indicators.json or .csv (json|csv)")
+	sign := flag.Bool("sign", false, "Sign every output file with the key from `ripcord keygen` (<file>.sig)")
+	maxAttachmentMB := flag.Int("max-attachment-mb", defaultAttachmentMaxMB, "Skip downloading attachments larger than this (0 = no limit)")
 
 	var keywords multiValue
 	flag.Var(&keywords, "keyword", "Case-insensitive keyword filter (repeatable)")
+	query := flag.String("query", "", `Boolean filter, e.g. 'breach AND (poc OR exploit) NOT test from:alice has:attachment'`)
+	var regexes, excludeKeywords, excludeUsers multiValue
+	flag.Var(&regexes, "regex", "Regular expression the content must match (repeatable, OR-matched)")
+	flag.Var(&excludeKeywords, "exclude-keyword", "Drop messages containing this keyword (repeatable)")
+	flag.Var(&excludeUsers, "exclude-user", "Drop messages from this username or ID (repeatable)")
+	includeBots := flag.Bool("include-bots", false, "Keep bot and webhook messages alongside everyone else's")
+	onlyBots := flag.Bool("only-bots", false, "Keep only bot and webhook messages")
+	var types multiValue
+	flag.Var(&types, "type", `Message types to keep, by name or number (repeatable; "system" for all events)`)
 
 	flag.Parse()
 
@@ -70,39 +131,210 @@ func parseConfig() (*runConfig, error) {
 		return nil, errors.New("missing Discord token (pass --token, set DISCORD_TOKEN, or run `ripcord set-token`)")
 	}
 
-	if *channel == "" {
-		return nil, errors.New("--channel is required")
+	fmtChoice, err := normalizeFormat(*format)
+	if err != nil {
+		return nil, err
 	}
 
-	fmtChoice, err := normalizeFormat(*format)
+	if err := validateOutput(*output, fmtChoice, *split); err != nil {
+		return nil, err
+	}
+	if err := validateDownload(*download, *output, *maxAttachmentMB, *concurrency); err != nil {
+		return nil, err
+	}
+	if err := validateIndicatorsFile(*indicatorsFile, *output); err != nil {
+		return nil, err
+	}
+	signingKey, err := resolveSigningKey(*sign, *output)
 	if err != nil {
 		return nil, err
 	}
+	columnNames := splitValues(columns)
+	if _, err := selectCSVColumns(columnNames); err != nil {
+		return nil, fmt.Errorf("invalid --columns value: %w", err)
+	}
+	if strings.TrimSpace(*output) == stdoutOutput {
+		// Progress lines would end up interleaved with the piped export.
+		*quiet = true
+	}
+
+	channelIDs := splitValues(channels)
+	if err := validateTargets(channelIDs, *guild, *split, *threads, *resume); err != nil {
+		return nil, err
+	}
+	if *resume != "" {
+		cfg, err := resumeConfig(*resume, resolvedToken, fmtChoice, *output, *quiet)
+		if err != nil {
+			return nil, err
+		}
+		cfg.NDJSONMeta = *ndjsonMeta
+		cfg.Columns = columnNames
+		cfg.Concurrency = *concurrency
+		cfg.DownloadAttachments = *download
+		cfg.MaxAttachmentBytes = int64(*maxAttachmentMB) << 20
+		cfg.ExtractIndicators = *extractIndicators
+		cfg.IndicatorsFile = *indicatorsFile
+		cfg.SigningKey = signingKey
+		return cfg, nil
+	}
 
 	since, until, err := resolveTimeWindow(*rangeStr, *daysBack, *hoursBack)
 	if err != nil {
 		return nil, err
 	}
+	bots, err := resolveBotMode(*includeBots, *onlyBots)
+	if err != nil {
+		return nil, err
+	}
+	typeNames, err := normalizeMessageTypes(types)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --type value: %w", err)
+	}
 
+	prefix := resolveOutputPrefix(*output, channelIDs, *guild)
 	cfg := &runConfig{
 		Token:        resolvedToken,
-		OutputPrefix: resolveOutputPrefix(*output, *channel),
+		OutputPrefix: prefix,
 		Format:       fmtChoice,
 		Quiet:        *quiet,
+		NDJSONMeta:   *ndjsonMeta,
+		Columns:      columnNames,
+		Split:        *split,
+		Concurrency:  *concurrency,
+		ChannelIDs:   channelIDs,
+
+		DownloadAttachments: *download,
+		MaxAttachmentBytes:  int64(*maxAttachmentMB) << 20,
+		ExtractIndicators:   *extractIndicators,
+		IndicatorsFile:      *indicatorsFile,
+		SigningKey:          signingKey,
 		Options: scrapeOptions{
-			ChannelID:   *channel,
-			Keywords:    normalizeStringList(keywords),
-			Users:       normalizeStringList(users),
-			MaxMessages: *maxMessages,
-			Since:       since,
-			Until:       until,
-			Quiet:       *quiet,
+			GuildID:         *guild,
+			Keywords:        normalizeStringList(keywords),
+			Users:           normalizeStringList(users),
+			Query:           strings.TrimSpace(*query),
+			Regexes:         regexes,
+			ExcludeKeywords: normalizeStringList(excludeKeywords),
+			ExcludeUsers:    normalizeStringList(excludeUsers),
+			Bots:            bots,
+			Types:           typeNames,
+			MaxMessages:     *maxMessages,
+			Since:           since,
+			Until:           until,
+			Threads:         *threads,
+			Quiet:           *quiet,
 		},
 	}
+	if len(channelIDs) == 1 {
+		cfg.Options.ChannelID = channelIDs[0]
+		if !*threads && prefix != stdoutOutput {
+			cfg.Options.CheckpointPath = checkpointPath(prefix)
+		}
+	}
+	if cfg.Options.filter, err = compileFilter(&cfg.Options); err != nil {
+		return nil, err
+	}
 
 	return cfg, nil
 }
 
+// validateTargets checks that exactly one of --channel/--guild/--resume picks
+// what to scrape and that the mode-specific flags fit it.
+func validateTargets(channelIDs []string, guild string, split, threads bool, resume string) error {
+	if resume != "" {
+		if guild != "" || threads || len(channelIDs) > 0 {
+			return errors.New("--resume takes the channel from the checkpoint and cannot be combined with --channel, --guild or --threads")
+		}
+		return nil
+	}
+	if len(channelIDs) == 0 && guild == "" {
+		return errors.New("--channel or --guild is required")
+	}
+	if len(channelIDs) > 0 && guild != "" {
+		return errors.New("--channel and --guild are mutually exclusive")
+	}
+	if split && len(channelIDs) == 1 {
+		return errors.New("--split requires --guild or more than one --channel")
+	}
+	return nil
+}
+
+// validateOutput rejects --output - for formats that write more than one
+// stream.
+func validateOutput(output, format string, split bool) error {
+	if strings.TrimSpace(output) != stdoutOutput {
+		return nil
+	}
+	if format != "ndjson" {
+		return errors.New("--output - requires --format ndjson")
+	}
+	if split {
+		return errors.New("--output - cannot be combined with --split")
+	}
+	return nil
+}
+
+// validateDownload checks --download-attachments against the flags it depends
+// on. Downloads land next to the output files, so stdout output has nowhere
+// to put them.
+func validateDownload(download bool, output string, maxMB, concurrency int) error {
+	if concurrency < 1 {
+		return errors.New("--concurrency must be at least 1")
+	}
+	if maxMB < 0 {
+		return errors.New("--max-attachment-mb cannot be negative")
+	}
+	if download && strings.TrimSpace(output) == stdoutOutput {
+		return errors.New("--download-attachments cannot be combined with --output -")
+	}
+	return nil
+}
+
+func validateIndicatorsFile(format, output string) error {
+	switch {
+	case format == "":
+		return nil
+	case format != "json" && format != "csv":
+		return errors.New("--indicators-file must be json or csv")
+	case strings.TrimSpace(output) == stdoutOutput:
+		return errors.New("--indicators-file cannot be combined with --output -")
+	}
+	return nil
+}
+
+func resolveBotMode(include, only bool) (string, error) {
+	switch {
+	case include && only:
+		return "", errors.New("--include-bots and --only-bots are mutually exclusive")
+	case include:
+		return botsInclude, nil
+	case only:
+		return botsOnly, nil
+	}
+	return "", nil
+}
+
+// splitValues flattens repeated and comma-separated flag values (--channel,
+// --columns), dropping duplicates while keeping the order given.
+func splitValues(values []string) []string {
+	var out []string
+	seen := make(map[string]struct{})
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			item := strings.TrimSpace(part)
+			if item == "" {
+				continue
+			}
+			if _, ok := seen[item]; ok {
+				continue
+			}
+			seen[item] = struct{}{}
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
 func resolveToken(flagValue string) string {
 	if t := strings.TrimSpace(flagValue); t != "" {
 		return t
@@ -119,12 +351,14 @@ func resolveToken(flagValue string) string {
 func normalizeFormat(format string) (string, error) {
 	choice := strings.ToLower(strings.TrimSpace(format))
 	switch choice {
-	case "json", "markdown", "both":
+	case "json", "markdown", "both", "ndjson", "csv", "tsv", "html", "sqlite", "stix", "misp":
 		return choice, nil
 	case "md":
 		return "markdown", nil
+	case "jsonl":
+		return "ndjson", nil
 	}
-	return "", errors.New("format must be one of json, markdown, or both")
+	return "", errors.New("format must be one of json, markdown, both, ndjson, csv, tsv, html, sqlite, stix, or misp")
 }
 
 func resolveTimeWindow(rangeStr string, daysBack, hoursBack int) (since, until *time.Time, err error) {
@@ -146,13 +380,19 @@ func resolveTimeWindow(rangeStr string, daysBack, hoursBack int) (since, until *
 	return nil, nil, errors.New("specify --range or a --days/--hours window")
 }
 
-func resolveOutputPrefix(flagValue, channel string) string {
+func resolveOutputPrefix(flagValue string, channels []string, guild string) string {
 	prefix := strings.TrimSpace(flagValue)
 	if prefix != "" {
 		return prefix
 	}
 	timestamp := time.Now().UTC().Format("20060102T150405Z")
-	return fmt.Sprintf("discord_%s_%s", channel, timestamp)
+	switch {
+	case guild != "":
+		return fmt.Sprintf("discord_guild_%s_%s", guild, timestamp)
+	case len(channels) > 1:
+		return fmt.Sprintf("discord_channels_%s", timestamp)
+	}
+	return fmt.Sprintf("discord_%s_%s", channels[0], timestamp)
 }
 
 func normalizeStringList(values []string) []string {
@@ -205,7 +445,7 @@ func parseRange(value string) (start, end time.Time, err error) {
 }
 
 func printUsage(w io.Writer, bin string) {
-	if _, err := fmt.Fprintf(w, usageText, bin, bin, bin, bin, bin); err != nil {
+	if _, err := fmt.Fprintf(w, usageText, bin, bin, bin, bin, bin, bin, bin, bin, bin, bin, bin, bin, bin, bin, bin, bin, bin); err != nil {
 		fmt.Fprintln(os.Stderr, "warning: failed to write usage:", err)
 	}
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,71 +13,110 @@ import (
 	"time"
 )
 
+// DiscordClient is safe for concurrent use; all goroutines share one rate
+// limiter and therefore one token-wide request budget.
 type DiscordClient struct {
-	token       string
-	httpClient  *http.Client
-	minInterval time.Duration
-	lastRequest time.Time
+	token      string
+	httpClient *http.Client
+	limiter    *rateLimiter
 }
 
 func NewDiscordClient(token string) *DiscordClient {
-	base := time.Second
-	interval := time.Duration(float64(base) / defaultRateLimit)
 	return &DiscordClient{
-		token:       token,
-		httpClient:  &http.Client{Timeout: 15 * time.Second},
-		minInterval: interval,
+		token:      token,
+		httpClient: &http.Client{Timeout: 15 * time.Second},
+		limiter:    newRateLimiter(),
 	}
 }
 
-func (c *DiscordClient) ScrapeChannel(opts *scrapeOptions) ([]Message, Stats, error) {
-	var results []Message
+// ScrapeChannel pages backward through a channel's history, appending each
+// page's matching messages (newest-first) to out so memory stays flat however
+// long the channel is. It returns how many messages out holds. If ctx is
+// canceled mid-scrape the messages spooled so far are kept and an
+// *interruptedError records the cursor pagination stopped at.
+func (c *DiscordClient) ScrapeChannel(ctx context.Context, opts *scrapeOptions, out *spoolStream) (int, Stats, error) {
 	var stats Stats
 	var before string
-	keywords := normalizeFilters(opts.Keywords)
-	users := normalizeFilters(opts.Users)
+	if opts.Resume != nil {
+		stats = opts.Resume.Stats
+		before = opts.Resume.Before
+	}
+	// With an absolute end, start paging at the snowflake for Until instead
+	// of walking back from the newest message. before is exclusive, so seek
+	// one millisecond past Until to keep messages stamped exactly at it.
+	//
+	// Since needs no matching after= seek: paging back stops at the first
+	// message older than Since (see collectBatch), so every page fetched
+	// already lies inside the window, and paging forward from Since would
+	// need the same number of requests. It would also change which messages
+	// --max keeps (the oldest instead of the newest) and break checkpoints,
+	// which record a before cursor.
+	var seek *seekTracker
+	if before == "" && opts.Until != nil {
+		before = snowflakeFromTime(opts.Until.Add(time.Millisecond))
+		stats.SeekCursor = before
+		seek = &seekTracker{until: opts.Until.UTC()}
+	}
+	finish := func() {
+		if seek != nil {
+			stats.RequestsSaved = seek.savedRequests(time.Now().UTC())
+		}
+	}
 
-	for {
-		batch, metrics, err := c.fetchBatch(opts.ChannelID, before, maxBatchSize)
-		stats.Requests += metrics.requests
-		stats.RateLimitHits += metrics.rateLimitHits
+	for batches := 1; ; batches++ {
+		batch, metrics, err := c.fetchBatch(ctx, opts.ChannelID, before, maxBatchSize)
+		stats.addMetrics(metrics)
+		if seek != nil {
+			seek.observe(batch)
+		}
 
 		if err != nil {
 			if errors.Is(err, errNoMoreMessages) {
 				break
 			}
-			return nil, stats, err
+			checkpointScrape(opts, before, stats, out)
+			if ctx.Err() != nil {
+				finish()
+				return out.count, stats, &interruptedError{before: before, cause: ctx.Err()}
+			}
+			return out.count, stats, err
 		}
 
 		if len(batch) == 0 {
 			break
 		}
 
-		var stop bool
-		results, stop = collectBatch(batch, results, opts, users, keywords)
-		if opts.MaxMessages > 0 && len(results) >= opts.MaxMessages {
-			return results[:opts.MaxMessages], stats, nil
+		kept, stop := collectBatch(batch, nil, opts)
+		if remaining := opts.MaxMessages - out.count; opts.MaxMessages > 0 && len(kept) >= remaining {
+			kept, stop = kept[:remaining], true
+		}
+		if err := out.append(kept); err != nil {
+			return out.count, stats, fmt.Errorf("spool messages: %w", err)
 		}
 		if stop {
 			break
 		}
 
 		before = batch[len(batch)-1].ID
+		if batches%checkpointInterval == 0 {
+			checkpointScrape(opts, before, stats, out)
+		}
 		if !opts.Quiet {
-			fmt.Printf("pulled %d messages so far\n", len(results))
+			fmt.Printf("pulled %d messages so far\n", out.count)
 		}
 	}
 
-	return results, stats, nil
+	finish()
+	return out.count, stats, nil
 }
 
 // collectBatch filters one page of API messages and appends keepers to results.
 // Returns updated results and stop=true when a message older than opts.Since is
 // reached (which means pagination should halt).
-func collectBatch(batch []apiMessage, results []Message, opts *scrapeOptions, users, keywords []string) ([]Message, bool) {
+func collectBatch(batch []apiMessage, results []Message, opts *scrapeOptions) ([]Message, bool) {
 	for i := range batch {
 		raw := &batch[i]
-		if raw.Author.Bot {
+		if !keepAuthor(opts.Bots, raw) {
 			continue
 		}
 
@@ -85,15 +125,15 @@ func collectBatch(batch []apiMessage, results []Message, opts *scrapeOptions, us
 			continue
 		}
 
-		if opts.Until != nil && msgTime.After(opts.Until.UTC()) {
+		if afterUntil(opts, msgTime) {
 			continue
 		}
-		if opts.Since != nil && msgTime.Before(opts.Since.UTC()) {
+		if beforeSince(opts, msgTime) {
 			return results, true
 		}
 
 		normalized := normalizeMessage(raw, msgTime)
-		if !messagePassesFilters(&normalized, users, keywords) {
+		if !messagePassesFilters(&normalized, opts) {
 			continue
 		}
 
@@ -102,6 +142,16 @@ func collectBatch(batch []apiMessage, results []Message, opts *scrapeOptions, us
 	return results, false
 }
 
+// afterUntil and beforeSince test a message time against the --range /
+// --days / --hours window; collectBatch and offline queries share them.
+func afterUntil(opts *scrapeOptions, t time.Time) bool {
+	return opts.Until != nil && t.After(opts.Until.UTC())
+}
+
+func beforeSince(opts *scrapeOptions, t time.Time) bool {
+	return opts.Since != nil && t.Before(opts.Since.UTC())
+}
+
 func parseMessageTime(timestamp string) (time.Time, bool) {
 	if t, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
 		return t.UTC(), true
@@ -112,101 +162,199 @@ func parseMessageTime(timestamp string) (time.Time, bool) {
 	return time.Time{}, false
 }
 
-func messagePassesFilters(msg *Message, users, keywords []string) bool {
-	if len(users) > 0 && !matchesUsers(&msg.Author, users) {
-		return false
-	}
-	if len(keywords) > 0 && !matchesKeywords(msg.Content, keywords) {
+// messagePassesFilters applies the compiled filter (nil matches everything)
+// and drops messages with nothing to export. Content-less system events
+// (joins, pins, boosts) are kept when --type asked for message types.
+func messagePassesFilters(msg *Message, opts *scrapeOptions) bool {
+	if opts.filter != nil && !opts.filter.match(newFilterMessage(msg)) {
 		return false
 	}
 	if msg.Content == "" && len(msg.Attachments) == 0 && msg.EmbedCount == 0 {
-		return false
+		return len(opts.Types) > 0 && isSystemMessage(msg.Type)
 	}
 	return true
 }
 
 var errNoMoreMessages = errors.New("no more messages")
 
-func (c *DiscordClient) fetchBatch(channelID, before string, limit int) ([]apiMessage, batchMetrics, error) {
-	var metrics batchMetrics
+func (c *DiscordClient) fetchBatch(ctx context.Context, channelID, before string, limit int) ([]apiMessage, batchMetrics, error) {
+	return c.fetchMessages(ctx, channelID, "before", before, limit)
+}
+
+// fetchBatchAfter pages forward from the given message ID. Discord still
+// returns each page newest-first.
+func (c *DiscordClient) fetchBatchAfter(ctx context.Context, channelID, after string, limit int) ([]apiMessage, batchMetrics, error) {
+	return c.fetchMessages(ctx, channelID, "after", after, limit)
+}
+
+func (c *DiscordClient) fetchMessages(ctx context.Context, channelID, direction, cursor string, limit int) ([]apiMessage, batchMetrics, error) {
 	endpoint := fmt.Sprintf("%s/channels/%s/messages", apiBase, channelID)
 
 	params := url.Values{}
 	params.Set("limit", strconv.Itoa(limit))
-	if before != "" {
-		params.Set("before", before)
+	if cursor != "" {
+		params.Set(direction, cursor)
 	}
 
+	var messages []apiMessage
+	metrics, err := c.getJSON(ctx, endpoint, params, &messages)
+	if err != nil {
+		return nil, metrics, err
+	}
+	if len(messages) == 0 {
+		return nil, metrics, errNoMoreMessages
+	}
+	return messages, metrics, nil
+}
+
+// apiError is a non-retryable Discord response. Callers use errors.As to
+// inspect the status (e.g. to skip channels the token cannot read).
+type apiError struct {
+	status int
+	body   string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("discord api returned %d: %s", e.status, e.body)
+}
+
+// isAccessDenied reports whether err is a 403 from Discord, which is what the
+// API returns for channels the token lacks VIEW_CHANNEL/READ_MESSAGE_HISTORY on.
+func isAccessDenied(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.status == http.StatusForbidden
+}
+
+// getJSON performs a throttled GET with retries for transport errors, 429s and
+// 5xx responses, decoding a 200 body into out. Cancellation of ctx aborts
+// waits and in-flight requests and is returned as ctx.Err().
+func (c *DiscordClient) getJSON(ctx context.Context, endpoint string, params url.Values, out any) (batchMetrics, error) {
+	var metrics batchMetrics
+	target := endpoint
+	if len(params) > 0 {
+		target += "?" + params.Encode()
+	}
+
+	route := rateLimitRoute(endpoint)
 	var lastErr error
 	for attempt := 0; attempt < 5; attempt++ {
-		c.throttle()
+		slept, proactive, err := c.limiter.wait(ctx, route)
+		metrics.slept += slept
+		if proactive {
+			metrics.proactiveWaits++
+		}
+		if err != nil {
+			return metrics, err
+		}
 
-		req, err := http.NewRequest(http.MethodGet, endpoint+"?"+params.Encode(), http.NoBody)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, http.NoBody)
 		if err != nil {
-			return nil, metrics, err
+			return metrics, err
 		}
 		req.Header.Set("Authorization", c.token)
 		req.Header.Set("User-Agent", userAgent)
 
 		resp, err := c.httpClient.Do(req)
 		if err != nil {
+			if ctx.Err() != nil {
+				return metrics, ctx.Err()
+			}
 			lastErr = err
-			time.Sleep(backoffDuration(attempt))
+			if err := sleepContext(ctx, backoffDuration(attempt)); err != nil {
+				return metrics, err
+			}
 			continue
 		}
 
 		metrics.requests++
+		c.limiter.update(route, resp.Header)
 
 		body, readErr := io.ReadAll(resp.Body)
 		closeErr := resp.Body.Close()
 		if combined := errors.Join(readErr, closeErr); combined != nil {
+			if ctx.Err() != nil {
+				return metrics, ctx.Err()
+			}
 			lastErr = combined
-			time.Sleep(backoffDuration(attempt))
+			if err := sleepContext(ctx, backoffDuration(attempt)); err != nil {
+				return metrics, err
+			}
 			continue
 		}
 
 		if resp.StatusCode == http.StatusOK {
-			var messages []apiMessage
-			if err := json.Unmarshal(body, &messages); err != nil {
-				return nil, metrics, err
-			}
-			if len(messages) == 0 {
-				return nil, metrics, errNoMoreMessages
-			}
-			return messages, metrics, nil
+			return metrics, json.Unmarshal(body, out)
 		}
 
 		if resp.StatusCode == http.StatusTooManyRequests {
 			metrics.rateLimitHits++
 			retryAfter := parseRetryAfter(body)
-			time.Sleep(retryAfter)
+			c.limiter.block(route, retryAfter, isGlobalRateLimit(resp.Header, body))
+			metrics.slept += retryAfter
+			if err := sleepContext(ctx, retryAfter); err != nil {
+				return metrics, err
+			}
 			continue
 		}
 
 		if resp.StatusCode >= 500 {
 			lastErr = fmt.Errorf("discord api error %d", resp.StatusCode)
-			time.Sleep(backoffDuration(attempt))
+			if err := sleepContext(ctx, backoffDuration(attempt)); err != nil {
+				return metrics, err
+			}
 			continue
 		}
 
-		return nil, metrics, fmt.Errorf("discord api returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		return metrics, &apiError{status: resp.StatusCode, body: strings.TrimSpace(string(body))}
 	}
 
 	if lastErr != nil {
-		return nil, metrics, lastErr
+		return metrics, lastErr
 	}
-	return nil, metrics, errors.New("maximum retries exceeded")
+	return metrics, errors.New("maximum retries exceeded")
+}
+
+// interruptedError reports a scrape cut short by cancellation. The results
+// returned alongside it are everything collected before the "before" cursor.
+type interruptedError struct {
+	before string
+	cause  error
 }
 
-func (c *DiscordClient) throttle() {
-	if c.minInterval <= 0 {
-		return
+func (e *interruptedError) Error() string {
+	if e.before == "" {
+		return fmt.Sprintf("scrape interrupted: %v", e.cause)
 	}
-	since := time.Since(c.lastRequest)
-	if since < c.minInterval {
-		time.Sleep(c.minInterval - since)
+	return fmt.Sprintf("scrape interrupted before message %s: %v", e.before, e.cause)
+}
+
+func (e *interruptedError) Unwrap() error {
+	return e.cause
+}
+
+// interruptedBefore reports whether err is an interruption and, if so, the
+// cursor pagination stopped at.
+func interruptedBefore(err error) (string, bool) {
+	var ie *interruptedError
+	if errors.As(err, &ie) {
+		return ie.before, true
+	}
+	return "", false
+}
+
+// sleepContext sleeps for d or until ctx is canceled, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
 	}
-	c.lastRequest = time.Now()
 }
 
 func parseRetryAfter(body []byte) time.Duration {
@@ -241,7 +389,8 @@ func normalizeMessage(raw *apiMessage, timestamp time.Time) Message {
 			ID:          raw.Author.ID,
 			Username:    chooseName(raw.Author.Username, raw.Author.GlobalName),
 			DisplayName: chooseDisplayName(&raw.Author),
-			Bot:         raw.Author.Bot,
+			Bot:         raw.Author.Bot && raw.WebhookID == "",
+			Webhook:     raw.WebhookID != "",
 		},
 		Content:    raw.Content,
 		Timestamp:  timestamp,
@@ -271,11 +420,25 @@ func normalizeMessage(raw *apiMessage, timestamp time.Time) Message {
 	if len(raw.Attachments) > 0 {
 		attachments := make([]Attachment, 0, len(raw.Attachments))
 		for i := range raw.Attachments {
-			attachments = append(attachments, Attachment(raw.Attachments[i]))
+			att := &raw.Attachments[i]
+			attachments = append(attachments, Attachment{
+				ID:          att.ID,
+				Filename:    att.Filename,
+				URL:         att.URL,
+				ContentType: att.ContentType,
+				Size:        att.Size,
+			})
 		}
 		msg.Attachments = attachments
 	}
 
+	if len(raw.Embeds) > 0 {
+		msg.Embeds = make([]Embed, 0, len(raw.Embeds))
+		for i := range raw.Embeds {
+			msg.Embeds = append(msg.Embeds, normalizeEmbed(&raw.Embeds[i]))
+		}
+	}
+
 	if len(raw.Reactions) > 0 {
 		reactions := make([]Reaction, 0, len(raw.Reactions))
 		for i := range raw.Reactions {
@@ -302,6 +465,51 @@ func normalizeMessage(raw *apiMessage, timestamp time.Time) Message {
 	return msg
 }
 
+func normalizeEmbed(raw *apiEmbed) Embed {
+	embed := Embed{
+		Type:        raw.Type,
+		Title:       raw.Title,
+		Description: raw.Description,
+		URL:         raw.URL,
+		Timestamp:   raw.Timestamp,
+		Color:       raw.Color,
+		Fields:      raw.Fields,
+	}
+	if raw.Author != nil {
+		embed.AuthorName, embed.AuthorURL = raw.Author.Name, raw.Author.URL
+	}
+	if raw.Provider != nil {
+		embed.ProviderName = raw.Provider.Name
+	}
+	if raw.Footer != nil {
+		embed.Footer = raw.Footer.Text
+	}
+	if raw.Image != nil {
+		embed.ImageURL = raw.Image.URL
+	}
+	if raw.Thumbnail != nil {
+		embed.ThumbnailURL = raw.Thumbnail.URL
+	}
+	if raw.Video != nil {
+		embed.VideoURL = raw.Video.URL
+	}
+	return embed
+}
+
+// keepAuthor applies the --include-bots/--only-bots mode: bot accounts and
+// webhooks are dropped by default, kept alongside people with "include", or
+// kept exclusively with "only".
+func keepAuthor(mode string, raw *apiMessage) bool {
+	automated := raw.Author.Bot || raw.WebhookID != ""
+	switch mode {
+	case botsInclude:
+		return true
+	case botsOnly:
+		return automated
+	}
+	return !automated
+}
+
 func chooseName(username, global string) string {
 	if global != "" {
 		return global
@@ -336,19 +544,6 @@ func normalizeFilters(values []string) []string {
 	return lower
 }
 
-func matchesKeywords(content string, keywords []string) bool {
-	if len(keywords) == 0 {
-		return true
-	}
-	text := strings.ToLower(content)
-	for _, kw := range keywords {
-		if strings.Contains(text, kw) {
-			return true
-		}
-	}
-	return false
-}
-
 func matchesUsers(author *Author, users []string) bool {
 	if len(users) == 0 {
 		return true
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeepAuthor(t *testing.T) {
+	human := &apiMessage{Author: apiAuthor{ID: "1", Username: "alice"}}
+	bot := &apiMessage{Author: apiAuthor{ID: "2", Username: "music", Bot: true}}
+	// Discord reports webhook posts with bot set; some integrations omit it.
+	webhook := &apiMessage{Author: apiAuthor{ID: "3", Username: "ci", Bot: true}, WebhookID: "3"}
+	bareWebhook := &apiMessage{Author: apiAuthor{ID: "4", Username: "feed"}, WebhookID: "4"}
+
+	tests := []struct {
+		mode string
+		want [4]bool
+	}{
+		{"", [4]bool{true, false, false, false}},
+		{botsInclude, [4]bool{true, true, true, true}},
+		{botsOnly, [4]bool{false, true, true, true}},
+	}
+	for _, tt := range tests {
+		for i, raw := range []*apiMessage{human, bot, webhook, bareWebhook} {
+			if got := keepAuthor(tt.mode, raw); got != tt.want[i] {
+				t.Errorf("keepAuthor(%q, %s) = %v, want %v", tt.mode, raw.Author.Username, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestResolveBotMode(t *testing.T) {
+	tests := []struct {
+		include, only bool
+		want          string
+		wantErr       bool
+	}{
+		{false, false, "", false},
+		{true, false, botsInclude, false},
+		{false, true, botsOnly, false},
+		{true, true, "", true},
+	}
+	for _, tt := range tests {
+		got, err := resolveBotMode(tt.include, tt.only)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("resolveBotMode(%v, %v) = %q, %v; want %q, error %v", tt.include, tt.only, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestNormalizeMessageSeparatesWebhooksFromBots(t *testing.T) {
+	ts := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		raw         apiMessage
+		bot, hooked bool
+	}{
+		{"user", apiMessage{Author: apiAuthor{ID: "1", Username: "alice"}}, false, false},
+		{"bot account", apiMessage{Author: apiAuthor{ID: "2", Username: "music", Bot: true}}, true, false},
+		{"webhook", apiMessage{Author: apiAuthor{ID: "3", Username: "ci", Bot: true}, WebhookID: "3"}, false, true},
+		{"webhook without bot flag", apiMessage{Author: apiAuthor{ID: "4", Username: "feed"}, WebhookID: "4"}, false, true},
+	}
+	for _, tt := range tests {
+		msg := normalizeMessage(&tt.raw, ts)
+		if msg.Author.Bot != tt.bot || msg.Author.Webhook != tt.hooked {
+			t.Errorf("%s: bot %v webhook %v, want %v %v", tt.name, msg.Author.Bot, msg.Author.Webhook, tt.bot, tt.hooked)
+		}
+	}
+}
@@ -1,9 +1,63 @@
 package main
 
+import "time"
+
 const (
-	apiBase          = "https://discord.com/api/v10"
-	userAgent        = "ripcord/0.1"
-	maxBatchSize     = 100
-	defaultRateLimit = 3.0 // requests per second
-	discordEnvFile   = ".discord.env"
+	apiBase        = "https://discord.com/api/v10"
+	userAgent      = "ripcord/0.1"
+	maxBatchSize   = 100
+	discordEnvFile = ".discord.env"
+
+	globalRateLimit    = 40.0 // requests per second shared by every goroutine
+	defaultConcurrency = 4
+
+	checkpointSuffix   = ".checkpoint.json"
+	checkpointInterval = 10 // batches between checkpoint writes
+	spoolSuffix        = ".spool"
+
+	stdoutOutput = "-" // --output value that streams to stdout
+
+	// keygen writes <config dir>/ripcord/ed25519.key and its .pub; --sign
+	// puts each signature next to the file it covers.
+	signingKeyDir   = "ripcord"
+	signingKeyFile  = "ed25519.key"
+	signatureSuffix = ".sig"
+
+	// --download-attachments saves files under <prefix>_files/, each capped
+	// at defaultAttachmentMaxMB unless --max-attachment-mb says otherwise.
+	attachmentDirSuffix    = "_files"
+	attachmentTimeout      = 2 * time.Minute
+	defaultAttachmentMaxMB = 25
+	maxAttachmentNameLen   = 100
+
+	// HTML transcripts group an author's consecutive messages sent within
+	// htmlGroupWindow, and keep the last htmlReplyCacheSize messages around
+	// for reply previews.
+	htmlGroupWindow     = 7 * time.Minute
+	htmlReplyCacheSize  = 10000
+	htmlReplySnippetLen = 120
+)
+
+// --include-bots and --only-bots modes as recorded in FilterSummary.Bots; the
+// default (empty) drops bot and webhook messages.
+const (
+	botsInclude = "include"
+	botsOnly    = "only"
+)
+
+// Discord channel types ripcord knows how to read. Forum and media channels
+// have no history of their own; their posts are threads.
+const (
+	channelTypeGuildText         = 0
+	channelTypeGuildAnnouncement = 5
+	channelTypeGuildForum        = 15
+	channelTypeGuildMedia        = 16
+)
+
+// Build metadata, set by goreleaser through -X ldflags and recorded in
+// evidence manifests.
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
 )
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvColumn is one flattened Message field in CSV/TSV exports.
+type csvColumn struct {
+	name  string
+	value func(*Message) string
+}
+
+// csvColumns lists every column in default order. List-valued fields are
+// joined with ";" and attachments/reactions are only counted here; their
+// details go to companion files keyed by message_id.
+var csvColumns = []csvColumn{
+	{"id", func(m *Message) string { return m.ID }},
+	{"timestamp", func(m *Message) string { return m.Timestamp.Format(time.RFC3339) }},
+	{"edited_timestamp", func(m *Message) string {
+		if m.EditedTimestamp == nil {
+			return ""
+		}
+		return m.EditedTimestamp.Format(time.RFC3339)
+	}},
+	{"channel_id", func(m *Message) string { return m.ChannelID }},
+	{"parent_channel_id", func(m *Message) string { return m.ParentChannelID }},
+	{"thread_name", func(m *Message) string { return m.ThreadName }},
+	{"author_id", func(m *Message) string { return m.Author.ID }},
+	{"author_username", func(m *Message) string { return m.Author.Username }},
+	{"author_display_name", func(m *Message) string { return m.Author.DisplayName }},
+	{"author_bot", func(m *Message) string { return strconv.FormatBool(m.Author.Bot) }},
+	{"author_webhook", func(m *Message) string { return strconv.FormatBool(m.Author.Webhook) }},
+	{"content", func(m *Message) string { return m.Content }},
+	{"type", func(m *Message) string { return strconv.Itoa(m.Type) }},
+	{"reply_to_message_id", func(m *Message) string {
+		if m.ReplyTo == nil {
+			return ""
+		}
+		return m.ReplyTo.MessageID
+	}},
+	{"reply_to_author_id", func(m *Message) string {
+		if m.ReplyTo == nil {
+			return ""
+		}
+		return m.ReplyTo.AuthorID
+	}},
+	{"mention_user_ids", func(m *Message) string { return strings.Join(m.MentionUserIDs, ";") }},
+	{"mention_role_ids", func(m *Message) string { return strings.Join(m.MentionRoleIDs, ";") }},
+	{"attachment_count", func(m *Message) string { return strconv.Itoa(len(m.Attachments)) }},
+	{"reaction_count", func(m *Message) string { return strconv.Itoa(len(m.Reactions)) }},
+	{"embed_count", func(m *Message) string { return strconv.Itoa(m.EmbedCount) }},
+}
+
+var (
+	attachmentColumns = []string{"message_id", "attachment_id", "filename", "url", "content_type", "size_bytes", "local_path", "sha256"}
+	reactionColumns   = []string{"message_id", "emoji", "count"}
+)
+
+// selectCSVColumns resolves a --columns value (comma-separated names, empty
+// for all) into columns in the order given.
+func selectCSVColumns(names []string) ([]csvColumn, error) {
+	if len(names) == 0 {
+		return csvColumns, nil
+	}
+	byName := make(map[string]csvColumn, len(csvColumns))
+	for _, col := range csvColumns {
+		byName[col.name] = col
+	}
+	selected := make([]csvColumn, 0, len(names))
+	for _, name := range names {
+		col, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q (available: %s)", name, strings.Join(csvColumnNames(), ", "))
+		}
+		selected = append(selected, col)
+	}
+	return selected, nil
+}
+
+func csvColumnNames() []string {
+	names := make([]string, 0, len(csvColumns))
+	for _, col := range csvColumns {
+		names = append(names, col.name)
+	}
+	return names
+}
+
+// writeDelimited writes the message table plus attachment and reaction
+// companion files (<prefix>.<ext>, <prefix>_attachments.<ext>,
+// <prefix>_reactions.<ext>) in a single pass over the export.
+func writeDelimited(prefix string, export *Export, names []string, sep rune, ext string) ([]string, error) {
+	columns, err := selectCSVColumns(names)
+	if err != nil {
+		return nil, err
+	}
+
+	base := stripExportExtension(prefix)
+	paths := []string{ensureExtension(base, ext), base + "_attachments" + ext, base + "_reactions" + ext}
+	tables, err := createTables(paths, sep)
+	if err != nil {
+		return nil, err
+	}
+	messages, attachments, reactions := tables[0], tables[1], tables[2]
+
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col.name
+	}
+	writeErr := messages.Write(header)
+	if writeErr == nil {
+		writeErr = attachments.Write(attachmentColumns)
+	}
+	if writeErr == nil {
+		writeErr = reactions.Write(reactionColumns)
+	}
+	if writeErr == nil {
+		row := make([]string, len(columns))
+		writeErr = forEachMessage(export, func(_ *ChannelExport, msg *Message) error {
+			for i, col := range columns {
+				row[i] = col.value(msg)
+			}
+			if err := messages.Write(row); err != nil {
+				return err
+			}
+			return writeCompanionRows(attachments, reactions, msg)
+		})
+	}
+
+	if err := closeTables(tables); err != nil && writeErr == nil {
+		writeErr = err
+	}
+	if writeErr != nil {
+		return nil, writeErr
+	}
+	return paths, nil
+}
+
+func writeCompanionRows(attachments, reactions *delimitedFile, msg *Message) error {
+	for i := range msg.Attachments {
+		att := &msg.Attachments[i]
+		row := []string{msg.ID, att.ID, att.Filename, att.URL, att.ContentType, strconv.FormatInt(att.Size, 10), att.LocalPath, att.SHA256}
+		if err := attachments.Write(row); err != nil {
+			return err
+		}
+	}
+	for i := range msg.Reactions {
+		react := &msg.Reactions[i]
+		if err := reactions.Write([]string{msg.ID, react.Emoji, strconv.Itoa(react.Count)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delimitedFile pairs a csv.Writer with the file it writes to.
+type delimitedFile struct {
+	*csv.Writer
+	file *os.File
+}
+
+func createTables(paths []string, sep rune) ([]*delimitedFile, error) {
+	tables := make([]*delimitedFile, 0, len(paths))
+	for _, path := range paths {
+		file, err := os.Create(filepath.Clean(path))
+		if err != nil {
+			_ = closeTables(tables)
+			return nil, err
+		}
+		w := csv.NewWriter(file)
+		w.Comma = sep
+		tables = append(tables, &delimitedFile{Writer: w, file: file})
+	}
+	return tables, nil
+}
+
+func closeTables(tables []*delimitedFile) error {
+	var firstErr error
+	for _, t := range tables {
+		t.Flush()
+		err := t.Error()
+		if cerr := t.file.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
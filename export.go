@@ -1,15 +1,25 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 )
 
 func writeOutputs(export *Export, cfg *runConfig) ([]string, error) {
+	if indicatorsEnabled(cfg) {
+		if err := summarizeIndicators(export); err != nil {
+			return nil, fmt.Errorf("extract indicators: %w", err)
+		}
+	}
+
 	var written []string
 	switch cfg.Format {
 	case "json":
@@ -17,7 +27,7 @@ func writeOutputs(export *Export, cfg *runConfig) ([]string, error) {
 		if !strings.HasSuffix(strings.ToLower(path), ".json") {
 			path += ".json"
 		}
-		if err := writeJSON(path, export); err != nil {
+		if err := writeExportJSON(path, export); err != nil {
 			return nil, err
 		}
 		written = append(written, path)
@@ -30,18 +40,139 @@ func writeOutputs(export *Export, cfg *runConfig) ([]string, error) {
 	case "both":
 		jsonPath := ensureExtension(cfg.OutputPrefix, ".json")
 		mdPath := ensureExtension(cfg.OutputPrefix, ".md")
-		if err := writeJSON(jsonPath, export); err != nil {
+		if err := writeExportJSON(jsonPath, export); err != nil {
 			return nil, err
 		}
 		if err := writeMarkdown(mdPath, export); err != nil {
 			return nil, err
 		}
 		written = append(written, jsonPath, mdPath)
+	case "ndjson":
+		path := cfg.OutputPrefix
+		if path != stdoutOutput {
+			path = ensureExtension(path, ".ndjson")
+		}
+		if err := writeNDJSONFile(path, export, cfg.NDJSONMeta); err != nil {
+			return nil, err
+		}
+		written = append(written, path)
+	case "html":
+		path := ensureExtension(cfg.OutputPrefix, ".html")
+		if err := writeHTML(path, export); err != nil {
+			return nil, err
+		}
+		written = append(written, path)
+	case "sqlite":
+		path := ensureExtension(cfg.OutputPrefix, ".sqlite")
+		if err := writeSQLite(path, export); err != nil {
+			return nil, err
+		}
+		written = append(written, path)
+	case "stix":
+		path := ensureExtension(cfg.OutputPrefix, stixExtension)
+		if err := writeSTIX(path, export); err != nil {
+			return nil, err
+		}
+		written = append(written, path)
+	case "misp":
+		path := ensureExtension(cfg.OutputPrefix, mispExtension)
+		if err := writeMISP(path, export); err != nil {
+			return nil, err
+		}
+		written = append(written, path)
+	case "csv", "tsv":
+		sep, ext := ',', ".csv"
+		if cfg.Format == "tsv" {
+			sep, ext = '\t', ".tsv"
+		}
+		paths, err := writeDelimited(cfg.OutputPrefix, export, cfg.Columns, sep, ext)
+		if err != nil {
+			return nil, err
+		}
+		written = append(written, paths...)
 	}
 
+	if cfg.IndicatorsFile != "" {
+		path, err := writeIndicatorsFile(cfg.OutputPrefix, export, cfg.IndicatorsFile)
+		if err != nil {
+			return nil, err
+		}
+		written = append(written, path)
+	}
 	return written, nil
 }
 
+// writeSectionedOutputs writes a guild sweep or multi-channel run either as
+// one combined export or, with --split, as one set of files per channel plus
+// an index manifest.
+func writeSectionedOutputs(export *Export, cfg *runConfig) ([]string, error) {
+	if !cfg.Split {
+		return writeOutputs(export, cfg)
+	}
+
+	base := stripExportExtension(cfg.OutputPrefix)
+	index := ExportIndex{
+		GuildID:    export.GuildID,
+		ExportedAt: export.ExportedAt,
+		Partial:    export.Partial,
+		Skipped:    export.Skipped,
+		Filters:    export.Filters,
+		Stats:      export.Stats,
+	}
+
+	var written []string
+	for i := range export.Channels {
+		section := &export.Channels[i]
+		guildID := section.GuildID
+		if guildID == "" {
+			guildID = export.GuildID
+		}
+		channelExport := Export{
+			GuildID:       guildID,
+			ChannelID:     section.ChannelID,
+			ExportedAt:    export.ExportedAt,
+			MessageCount:  section.MessageCount,
+			Partial:       section.Partial,
+			StoppedBefore: section.StoppedBefore,
+			Messages:      section.Messages,
+			Filters:       export.Filters,
+			Stats:         section.Stats,
+			source:        section.source,
+		}
+		channelCfg := *cfg
+		channelCfg.OutputPrefix = fmt.Sprintf("%s_%s", base, section.ChannelID)
+		files, err := writeOutputs(&channelExport, &channelCfg)
+		if err != nil {
+			return nil, err
+		}
+		written = append(written, files...)
+		index.Channels = append(index.Channels, ExportIndexEntry{
+			ChannelID:     section.ChannelID,
+			Name:          section.Name,
+			MessageCount:  section.MessageCount,
+			Partial:       section.Partial,
+			StoppedBefore: section.StoppedBefore,
+			Files:         files,
+		})
+	}
+
+	indexPath := base + "_index.json"
+	if err := writeJSON(indexPath, &index); err != nil {
+		return nil, err
+	}
+	return append(written, indexPath), nil
+}
+
+func stripExportExtension(prefix string) string {
+	lower := strings.ToLower(prefix)
+	for _, ext := range []string{".ndjson", stixExtension, mispExtension, ".json", ".md", ".csv", ".tsv", ".html", ".sqlite"} {
+		if strings.HasSuffix(lower, ext) {
+			return prefix[:len(prefix)-len(ext)]
+		}
+	}
+	return prefix
+}
+
 func ensureExtension(prefix, ext string) string {
 	cleaned := prefix
 	if strings.HasSuffix(strings.ToLower(cleaned), strings.ToLower(ext)) {
@@ -50,7 +181,7 @@ func ensureExtension(prefix, ext string) string {
 	return cleaned + ext
 }
 
-func writeJSON(path string, export *Export) (err error) {
+func writeJSON(path string, v any) (err error) {
 	file, err := os.Create(filepath.Clean(path))
 	if err != nil {
 		return err
@@ -63,66 +194,384 @@ func writeJSON(path string, export *Export) (err error) {
 
 	enc := json.NewEncoder(file)
 	enc.SetIndent("", "  ")
-	return enc.Encode(export)
+	return enc.Encode(v)
 }
 
-func writeMarkdown(path string, export *Export) error {
-	var b strings.Builder
-	fmt.Fprintf(&b, "# Discord export for channel %s\n\n", export.ChannelID)
-	fmt.Fprintf(&b, "- Exported at: %s\n", export.ExportedAt.Format(time.RFC3339))
-	fmt.Fprintf(&b, "- Messages: %d\n", export.MessageCount)
+// writeExportJSON writes an export exactly as writeJSON would, but streams
+// spooled messages into the output one at a time instead of materializing
+// them. The export is marshaled with a single placeholder message standing in
+// for each spooled list; each placeholder is then replaced by the real
+// messages, indented to match.
+func writeExportJSON(path string, export *Export) (err error) {
+	tmpl := *export
+	var sources []messageSource
+	placeholder := func(src messageSource) []Message {
+		sources = append(sources, src)
+		return []Message{{ID: spoolPlaceholderID(len(sources) - 1)}}
+	}
+	if export.source != nil && export.source.len() > 0 {
+		tmpl.Messages = placeholder(export.source)
+	}
+	if len(export.Channels) > 0 {
+		tmpl.Channels = append([]ChannelExport(nil), export.Channels...)
+		for i := range tmpl.Channels {
+			section := &tmpl.Channels[i]
+			if section.source != nil && section.source.len() > 0 {
+				section.Messages = placeholder(section.source)
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(&tmpl, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := file.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	w := bufio.NewWriter(file)
+	for i, src := range sources {
+		start, end, prefix, err := findPlaceholder(data, i)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data[:start]); err != nil {
+			return err
+		}
+		if err := writeIndentedMessages(w, src, prefix); err != nil {
+			return err
+		}
+		data = data[end:]
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.WriteByte('\n'); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func spoolPlaceholderID(i int) string {
+	return fmt.Sprintf("ripcord:spool:%d", i)
+}
+
+// findPlaceholder locates the i-th placeholder message object in data,
+// returning its byte range and the indentation it was marshaled at.
+func findPlaceholder(data []byte, i int) (start, end int, prefix string, err error) {
+	id := spoolPlaceholderID(i)
+	at := bytes.Index(data, []byte(`"id": "`+id+`"`))
+	if at < 0 {
+		return 0, 0, "", fmt.Errorf("export template is missing %s", id)
+	}
+	start = bytes.LastIndexByte(data[:at], '{')
+	prefix = string(data[bytes.LastIndexByte(data[:start], '\n')+1 : start])
+
+	want, err := json.MarshalIndent(Message{ID: id}, prefix, "  ")
+	if err != nil {
+		return 0, 0, "", err
+	}
+	end = start + len(want)
+	if end > len(data) || !bytes.Equal(data[start:end], want) {
+		return 0, 0, "", fmt.Errorf("export template has a malformed %s", id)
+	}
+	return start, end, prefix, nil
+}
+
+func writeIndentedMessages(w *bufio.Writer, src messageSource, prefix string) error {
+	sep := []byte(",\n" + prefix)
+	first := true
+	return eachMessage(src, func(msg *Message) error {
+		if !first {
+			if _, err := w.Write(sep); err != nil {
+				return err
+			}
+		}
+		first = false
+		data, err := json.MarshalIndent(msg, prefix, "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+}
+
+// loadExport reads a ripcord JSON export back into memory.
+func loadExport(path string) (*Export, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	var export Export
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &export, nil
+}
+
+func writeMarkdown(path string, export *Export) (err error) {
+	file, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := file.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	w := bufio.NewWriter(file)
+	writeMarkdownHeader(w, export)
+	writeMarkdownIndicators(w, export.Indicators)
+
+	if export.ChannelID == "" {
+		for i := range export.Channels {
+			section := &export.Channels[i]
+			fmt.Fprintf(w, "\n## #%s (%s)\n\n", section.Name, section.ChannelID)
+			fmt.Fprintf(w, "- Messages: %d\n", section.MessageCount)
+			if section.Partial {
+				fmt.Fprintf(w, "- Partial: interrupted%s\n", stoppedSuffix(section.StoppedBefore))
+			}
+			if err := writeMarkdownMessages(w, section.messages(), "###"); err != nil {
+				return err
+			}
+		}
+		if len(export.Skipped) > 0 {
+			fmt.Fprint(w, "\n## Skipped channels\n\n")
+			for i := range export.Skipped {
+				sk := &export.Skipped[i]
+				fmt.Fprintf(w, "- #%s (%s): %s\n", sk.Name, sk.ChannelID, sk.Reason)
+			}
+		}
+	} else if err := writeMarkdownMessages(w, export.messages(), "##"); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+func writeMarkdownHeader(b io.Writer, export *Export) {
+	switch {
+	case export.ChannelID != "":
+		fmt.Fprintf(b, "# Discord export for channel %s\n\n", export.ChannelID)
+	case export.GuildID != "":
+		fmt.Fprintf(b, "# Discord export for guild %s\n\n", export.GuildID)
+	default:
+		fmt.Fprintln(b, "# Discord export for multiple channels")
+		fmt.Fprintln(b)
+	}
+	fmt.Fprintf(b, "- Exported at: %s\n", export.ExportedAt.Format(time.RFC3339))
+	fmt.Fprintf(b, "- Messages: %d\n", export.MessageCount)
+	if export.Partial {
+		fmt.Fprintf(b, "- Partial: interrupted%s\n", stoppedSuffix(export.StoppedBefore))
+	}
+	if len(export.Channels) > 0 {
+		fmt.Fprintf(b, "- Channels: %d\n", len(export.Channels))
+	}
 	if export.Filters.Since != nil {
-		fmt.Fprintf(&b, "- Since: %s\n", export.Filters.Since.Format(time.RFC3339))
+		fmt.Fprintf(b, "- Since: %s\n", export.Filters.Since.Format(time.RFC3339))
 	}
 	if export.Filters.Until != nil {
-		fmt.Fprintf(&b, "- Until: %s\n", export.Filters.Until.Format(time.RFC3339))
+		fmt.Fprintf(b, "- Until: %s\n", export.Filters.Until.Format(time.RFC3339))
 	}
 	if len(export.Filters.Keywords) > 0 {
-		fmt.Fprintf(&b, "- Keywords: %s\n", strings.Join(export.Filters.Keywords, ", "))
+		fmt.Fprintf(b, "- Keywords: %s\n", strings.Join(export.Filters.Keywords, ", "))
 	}
 	if len(export.Filters.Users) > 0 {
-		fmt.Fprintf(&b, "- Users: %s\n", strings.Join(export.Filters.Users, ", "))
+		fmt.Fprintf(b, "- Users: %s\n", strings.Join(export.Filters.Users, ", "))
+	}
+	if export.Filters.Query != "" {
+		fmt.Fprintf(b, "- Query: %s\n", export.Filters.Query)
+	}
+	if len(export.Filters.Regexes) > 0 {
+		fmt.Fprintf(b, "- Regex: %s\n", strings.Join(export.Filters.Regexes, ", "))
+	}
+	if len(export.Filters.ExcludeKeywords) > 0 {
+		fmt.Fprintf(b, "- Excluded keywords: %s\n", strings.Join(export.Filters.ExcludeKeywords, ", "))
+	}
+	if len(export.Filters.ExcludeUsers) > 0 {
+		fmt.Fprintf(b, "- Excluded users: %s\n", strings.Join(export.Filters.ExcludeUsers, ", "))
+	}
+	if export.Filters.Bots != "" {
+		fmt.Fprintf(b, "- Bots and webhooks: %s\n", export.Filters.Bots)
+	}
+	if len(export.Filters.Types) > 0 {
+		fmt.Fprintf(b, "- Message types: %s\n", strings.Join(export.Filters.Types, ", "))
 	}
 	if export.Filters.Limit > 0 {
-		fmt.Fprintf(&b, "- Limit: %d\n", export.Filters.Limit)
+		fmt.Fprintf(b, "- Limit: %d\n", export.Filters.Limit)
 	}
 	if export.Stats.Requests > 0 {
-		fmt.Fprintf(&b, "- API requests: %d\n", export.Stats.Requests)
+		fmt.Fprintf(b, "- API requests: %d\n", export.Stats.Requests)
 	}
 	if export.Stats.RateLimitHits > 0 {
-		fmt.Fprintf(&b, "- Rate limit waits: %d\n", export.Stats.RateLimitHits)
+		fmt.Fprintf(b, "- Rate limit waits: %d\n", export.Stats.RateLimitHits)
+	}
+	if export.Stats.ProactiveWaits > 0 {
+		fmt.Fprintf(b, "- Proactive rate limit pauses: %d\n", export.Stats.ProactiveWaits)
+	}
+	if export.Stats.RateLimitSleepMS > 0 {
+		fmt.Fprintf(b, "- Time spent rate limited: %s\n", time.Duration(export.Stats.RateLimitSleepMS)*time.Millisecond)
+	}
+	if export.Stats.RequestsSaved > 0 {
+		fmt.Fprintf(b, "- Requests saved by snowflake seek (est.): %d\n", export.Stats.RequestsSaved)
 	}
+}
 
-	for i := range export.Messages {
-		msg := &export.Messages[i]
-		fmt.Fprintf(&b, "\n## %s — %s\n\n", msg.Timestamp.Format("2006-01-02 15:04:05 MST"), describeAuthor(&msg.Author))
-		if msg.Content != "" {
-			fmt.Fprintf(&b, "%s\n\n", msg.Content)
-		}
-		if len(msg.Attachments) > 0 {
-			fmt.Fprintln(&b, "**Attachments:**")
-			for j := range msg.Attachments {
-				att := &msg.Attachments[j]
-				fmt.Fprintf(&b, "- [%s](%s)\n", att.Filename, att.URL)
+// writeMarkdownMessages renders each message under a heading of the given
+// level ("##" for single-channel exports, "###" inside guild sections).
+// Thread messages are grouped after the channel's own messages, one section
+// per thread in order of first appearance.
+func writeMarkdownMessages(w io.Writer, src messageSource, heading string) error {
+	groups := src.groups()
+	err := drain(groups[0], func(msg *Message) error {
+		writeMarkdownMessage(w, msg, heading)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups[1:] {
+		first := true
+		err := drain(group, func(msg *Message) error {
+			if first {
+				fmt.Fprintf(w, "\n%s Thread: %s (%s)\n", heading, msg.ThreadName, msg.ChannelID)
+				first = false
 			}
-			fmt.Fprintln(&b)
+			writeMarkdownMessage(w, msg, heading+"#")
+			return nil
+		})
+		if err != nil {
+			return err
 		}
-		if len(msg.Reactions) > 0 {
-			parts := make([]string, 0, len(msg.Reactions))
-			for j := range msg.Reactions {
-				react := &msg.Reactions[j]
-				parts = append(parts, fmt.Sprintf("%s ×%d", react.Emoji, react.Count))
+	}
+	return nil
+}
+
+func writeMarkdownMessage(b io.Writer, msg *Message, heading string) {
+	if isSystemMessage(msg.Type) {
+		writeMarkdownSystemEvent(b, msg)
+		return
+	}
+	fmt.Fprintf(b, "\n%s %s — %s\n\n", heading, msg.Timestamp.Format("2006-01-02 15:04:05 MST"), describeAuthor(&msg.Author))
+	if msg.Content != "" {
+		fmt.Fprintf(b, "%s\n\n", msg.Content)
+	}
+	for i := range msg.Embeds {
+		writeMarkdownEmbed(b, &msg.Embeds[i])
+	}
+	if len(msg.Attachments) > 0 {
+		fmt.Fprintln(b, "**Attachments:**")
+		for j := range msg.Attachments {
+			att := &msg.Attachments[j]
+			if att.LocalPath == "" {
+				fmt.Fprintf(b, "- [%s](%s)\n", att.Filename, att.URL)
+				continue
 			}
-			fmt.Fprintf(&b, "**Reactions:** %s\n\n", strings.Join(parts, ", "))
+			fmt.Fprintf(b, "- [%s](%s) (sha256 `%s`, [original](%s))\n", att.Filename, att.LocalPath, att.SHA256, att.URL)
+		}
+		fmt.Fprintln(b)
+	}
+	if len(msg.Reactions) > 0 {
+		parts := make([]string, 0, len(msg.Reactions))
+		for j := range msg.Reactions {
+			react := &msg.Reactions[j]
+			parts = append(parts, fmt.Sprintf("%s ×%d", react.Emoji, react.Count))
+		}
+		fmt.Fprintf(b, "**Reactions:** %s\n\n", strings.Join(parts, ", "))
+	}
+}
+
+// writeMarkdownSystemEvent renders joins, pins, boosts and other events as a
+// single italic line instead of a message heading, so they stand apart from
+// the conversation. Content (e.g. a new thread's name) is appended.
+func writeMarkdownSystemEvent(b io.Writer, msg *Message) {
+	text := systemEventText(msg)
+	if msg.Content != "" {
+		text += ": " + strings.Join(strings.Fields(msg.Content), " ")
+	}
+	fmt.Fprintf(b, "\n_%s · %s_ `[%s]`\n", msg.Timestamp.Format("2006-01-02 15:04:05 MST"), text, messageTypeName(msg.Type))
+}
+
+// writeMarkdownEmbed renders an embed as a blockquote so it reads as quoted
+// material rather than the author's own words.
+func writeMarkdownEmbed(b io.Writer, e *Embed) {
+	var lines []string
+	if byline := slices.DeleteFunc([]string{e.ProviderName, e.AuthorName}, func(s string) bool { return s == "" }); len(byline) > 0 {
+		lines = append(lines, "_"+strings.Join(byline, " · ")+"_")
+	}
+	switch {
+	case e.Title != "" && e.URL != "":
+		lines = append(lines, fmt.Sprintf("**[%s](%s)**", e.Title, e.URL))
+	case e.Title != "":
+		lines = append(lines, "**"+e.Title+"**")
+	case e.URL != "":
+		lines = append(lines, e.URL)
+	}
+	if e.Description != "" {
+		lines = append(lines, strings.Split(e.Description, "\n")...)
+	}
+	for _, f := range e.Fields {
+		lines = append(lines, fmt.Sprintf("**%s:** %s", f.Name, strings.ReplaceAll(f.Value, "\n", " ")))
+	}
+	for _, media := range []string{e.ImageURL, e.ThumbnailURL, e.VideoURL} {
+		if media != "" {
+			lines = append(lines, "Media: "+media)
 		}
 	}
+	if e.Footer != "" {
+		lines = append(lines, "_"+e.Footer+"_")
+	}
+	if len(lines) == 0 {
+		return
+	}
+	for _, line := range lines {
+		fmt.Fprintf(b, "> %s\n", line)
+	}
+	fmt.Fprintln(b)
+}
+
+// writeMarkdownIndicators lists the export's indicators as a table ahead of
+// the transcript so they can be triaged without reading every message.
+func writeMarkdownIndicators(b io.Writer, indicators []IndicatorSummary) {
+	if len(indicators) == 0 {
+		return
+	}
+	fmt.Fprint(b, "\n## Indicators\n\n| Type | Value | Count | First seen | Last seen |\n|------|-------|-------|------------|-----------|\n")
+	for i := range indicators {
+		s := &indicators[i]
+		fmt.Fprintf(b, "| %s | `%s` | %d | %s (%s) | %s (%s) |\n", s.Type, strings.ReplaceAll(s.Value, "|", "\\|"), s.Count,
+			s.FirstSeenAt.Format(time.RFC3339), s.FirstSeenID, s.LastSeenAt.Format(time.RFC3339), s.LastSeenID)
+	}
+}
 
-	return os.WriteFile(filepath.Clean(path), []byte(b.String()), 0o600)
+func stoppedSuffix(before string) string {
+	if before == "" {
+		return ""
+	}
+	return fmt.Sprintf(" before message %s", before)
 }
 
 func describeAuthor(author *Author) string {
+	name := author.Username
 	if author.DisplayName != "" && author.DisplayName != author.Username {
-		return fmt.Sprintf("%s (%s)", author.DisplayName, author.Username)
+		name = fmt.Sprintf("%s (%s)", author.DisplayName, author.Username)
+	}
+	switch {
+	case author.Webhook:
+		name += " [webhook]"
+	case author.Bot:
+		name += " [bot]"
 	}
-	return author.Username
+	return name
 }
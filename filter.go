@@ -0,0 +1,542 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// messageFilter is a compiled --query expression combined with the
+// --keyword, --user, --regex and exclusion flags. It is built once when the
+// run is configured and evaluated against every message; nodes are
+// immutable, so one filter can be shared by concurrent channel workers.
+type messageFilter interface {
+	match(m *filterMessage) bool
+}
+
+// filterMessage caches the normalized forms of a message that text nodes
+// match against. text is the content followed by any embed text, one part
+// per line, so feeds that post everything in embeds are still searchable.
+type filterMessage struct {
+	*Message
+	text  string
+	lower string
+}
+
+func newFilterMessage(msg *Message) *filterMessage {
+	text := messageText(msg)
+	return &filterMessage{Message: msg, text: text, lower: strings.ToLower(strings.Join(strings.Fields(text), " "))}
+}
+
+// messageText joins a message's content with the searchable text of its
+// embeds: titles, descriptions, authors, fields and footers.
+func messageText(msg *Message) string {
+	if len(msg.Embeds) == 0 {
+		return msg.Content
+	}
+	parts := []string{msg.Content}
+	for i := range msg.Embeds {
+		e := &msg.Embeds[i]
+		parts = append(parts, e.Title, e.Description, e.AuthorName)
+		for _, f := range e.Fields {
+			parts = append(parts, f.Name, f.Value)
+		}
+		parts = append(parts, e.Footer)
+	}
+	return strings.Join(slices.DeleteFunc(parts, func(s string) bool { return s == "" }), "\n")
+}
+
+// compileFilter builds the filter for opts: --keyword values OR-ed as
+// substrings, --user values OR-ed as authors, --regex patterns OR-ed,
+// --type values OR-ed, the --query expression, and the negated
+// --exclude-keyword/--exclude-user lists, all AND-ed together. It returns
+// nil when there is nothing to filter on.
+func compileFilter(opts *scrapeOptions) (messageFilter, error) {
+	var parts andFilter
+	if keywords := normalizeFilters(opts.Keywords); len(keywords) > 0 {
+		parts = append(parts, anySubstring(keywords))
+	}
+	if users := normalizeFilters(opts.Users); len(users) > 0 {
+		parts = append(parts, fromFilter(users))
+	}
+	if len(opts.Regexes) > 0 {
+		var anyPattern orFilter
+		for _, pattern := range opts.Regexes {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --regex %q: %w", pattern, err)
+			}
+			anyPattern = append(anyPattern, regexFilter{re})
+		}
+		parts = append(parts, anyPattern)
+	}
+	if len(opts.Types) > 0 {
+		types, err := newTypeFilter(opts.Types)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --type: %w", err)
+		}
+		parts = append(parts, types)
+	}
+	if excluded := normalizeFilters(opts.ExcludeKeywords); len(excluded) > 0 {
+		parts = append(parts, notFilter{inner: anySubstring(excluded)})
+	}
+	if excluded := normalizeFilters(opts.ExcludeUsers); len(excluded) > 0 {
+		parts = append(parts, notFilter{inner: fromFilter(excluded)})
+	}
+	if strings.TrimSpace(opts.Query) != "" {
+		expr, err := parseQuery(opts.Query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --query: %w", err)
+		}
+		parts = append(parts, expr)
+	}
+
+	switch len(parts) {
+	case 0:
+		return nil, nil
+	case 1:
+		return parts[0], nil
+	}
+	return parts, nil
+}
+
+// applyContentFilters copies the content and author filters recorded in an export or
+// checkpoint onto opts so a sync or resume keeps matching the same messages.
+func applyContentFilters(opts *scrapeOptions, f *FilterSummary) {
+	opts.Keywords = f.Keywords
+	opts.Users = f.Users
+	opts.Query = f.Query
+	opts.Regexes = f.Regexes
+	opts.ExcludeKeywords = f.ExcludeKeywords
+	opts.ExcludeUsers = f.ExcludeUsers
+	opts.Bots = f.Bots
+	opts.Types = f.Types
+}
+
+// anySubstring matches any of the lower-cased values. Runs of whitespace in
+// each value are collapsed the same way filterMessage.lower collapses the
+// text, so a keyword spanning a line break or double space still matches.
+func anySubstring(values []string) orFilter {
+	var filters orFilter
+	for _, v := range values {
+		filters = append(filters, substringFilter(strings.Join(strings.Fields(v), " ")))
+	}
+	return filters
+}
+
+type andFilter []messageFilter
+
+func (f andFilter) match(m *filterMessage) bool {
+	for _, part := range f {
+		if !part.match(m) {
+			return false
+		}
+	}
+	return true
+}
+
+type orFilter []messageFilter
+
+func (f orFilter) match(m *filterMessage) bool {
+	for _, part := range f {
+		if part.match(m) {
+			return true
+		}
+	}
+	return false
+}
+
+type notFilter struct{ inner messageFilter }
+
+func (f notFilter) match(m *filterMessage) bool { return !f.inner.match(m) }
+
+// substringFilter is the legacy --keyword match: a case-insensitive
+// substring anywhere in the content, compared with whitespace collapsed.
+type substringFilter string
+
+func (f substringFilter) match(m *filterMessage) bool {
+	return strings.Contains(m.lower, string(f))
+}
+
+// regexFilter matches a --regex pattern against the raw content and embed
+// text, so case and line breaks are significant unless the pattern says
+// otherwise.
+type regexFilter struct{ re *regexp.Regexp }
+
+func (f regexFilter) match(m *filterMessage) bool { return f.re.MatchString(m.text) }
+
+// wordFilter matches a word or quoted phrase on word boundaries, so "poc"
+// does not match "epoch". A trailing * makes it a prefix match.
+type wordFilter struct {
+	text   string
+	prefix bool
+}
+
+func (f wordFilter) match(m *filterMessage) bool {
+	text := m.lower
+	for offset := 0; ; {
+		i := strings.Index(text[offset:], f.text)
+		if i < 0 {
+			return false
+		}
+		start := offset + i
+		end := start + len(f.text)
+		if wordBoundaryBefore(text, start) && (f.prefix || wordBoundaryAfter(text, end)) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(text[start:])
+		offset = start + size
+	}
+}
+
+func wordBoundaryBefore(text string, i int) bool {
+	if i == 0 {
+		return true
+	}
+	r, _ := utf8.DecodeLastRuneInString(text[:i])
+	return !isWordRune(r)
+}
+
+func wordBoundaryAfter(text string, i int) bool {
+	if i >= len(text) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(text[i:])
+	return !isWordRune(r)
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// fromFilter matches authors the same way --user does.
+type fromFilter []string
+
+func (f fromFilter) match(m *filterMessage) bool { return matchesUsers(&m.Author, f) }
+
+type mentionsFilter string
+
+func (f mentionsFilter) match(m *filterMessage) bool {
+	id := string(f)
+	return slices.Contains(m.MentionUserIDs, id) || slices.Contains(m.MentionRoleIDs, id)
+}
+
+type hasFilter string
+
+// hasKinds lists the values has: accepts.
+var hasKinds = []string{"attachment", "image", "file", "link", "embed", "reaction", "reply", "mention", "thread"}
+
+func (f hasFilter) match(m *filterMessage) bool {
+	switch string(f) {
+	case "attachment":
+		return len(m.Attachments) > 0
+	case "image", "file":
+		for i := range m.Attachments {
+			if isImageAttachment(&m.Attachments[i]) == (f == "image") {
+				return true
+			}
+		}
+		return false
+	case "link":
+		return strings.Contains(m.lower, "http://") || strings.Contains(m.lower, "https://")
+	case "embed":
+		return m.EmbedCount > 0
+	case "reaction":
+		return len(m.Reactions) > 0
+	case "reply":
+		return m.ReplyTo != nil
+	case "mention":
+		return len(m.MentionUserIDs) > 0 || len(m.MentionRoleIDs) > 0
+	case "thread":
+		return m.ParentChannelID != ""
+	}
+	return false
+}
+
+// timeFilter implements before: (exclusive) and after: (inclusive).
+type timeFilter struct {
+	at     time.Time
+	before bool
+}
+
+func (f timeFilter) match(m *filterMessage) bool {
+	if f.before {
+		return m.Timestamp.Before(f.at)
+	}
+	return !m.Timestamp.Before(f.at)
+}
+
+// parseQuery compiles a --query expression. Grammar, loosest binding first:
+//
+//	expr    = and { "OR" and }
+//	and     = unary { ["AND"] unary }      adjacent terms are AND-ed
+//	unary   = "NOT" unary | "(" expr ")" | term
+//	term    = word | "quoted phrase" | field ":" value
+//
+// Operators must be upper case; lower-case "and"/"or"/"not" are words.
+func parseQuery(query string) (messageFilter, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok, ok := p.peek(); ok {
+		return nil, fmt.Errorf("unexpected %q", tok.text)
+	}
+	return expr, nil
+}
+
+type queryTokenKind int
+
+const (
+	tokenTerm queryTokenKind = iota
+	tokenPhrase
+	tokenField
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type queryToken struct {
+	kind  queryTokenKind
+	text  string
+	field string
+}
+
+func tokenizeQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, queryToken{kind: tokenOpen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{kind: tokenClose, text: ")"})
+			i++
+		case c == '"':
+			text, next, err := readQuoted(query, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, queryToken{kind: tokenPhrase, text: text})
+			i = next
+		default:
+			tok, next, err := readBareToken(query, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, tok)
+			i = next
+		}
+	}
+	return tokens, nil
+}
+
+func readQuoted(query string, start int) (string, int, error) {
+	end := strings.IndexByte(query[start+1:], '"')
+	if end < 0 {
+		return "", 0, errors.New("unterminated quoted phrase")
+	}
+	return query[start+1 : start+1+end], start + end + 2, nil
+}
+
+// readBareToken reads an operator, word, or field:value pair. A field value
+// may itself be quoted, as in from:"Display Name".
+func readBareToken(query string, start int) (queryToken, int, error) {
+	end := start
+	for end < len(query) && !strings.ContainsRune(" \t\r\n()\"", rune(query[end])) {
+		end++
+	}
+	word := query[start:end]
+
+	switch word {
+	case "AND":
+		return queryToken{kind: tokenAnd, text: word}, end, nil
+	case "OR":
+		return queryToken{kind: tokenOr, text: word}, end, nil
+	case "NOT":
+		return queryToken{kind: tokenNot, text: word}, end, nil
+	}
+
+	field, value, ok := strings.Cut(word, ":")
+	if !ok || !isQueryField(strings.ToLower(field)) {
+		return queryToken{kind: tokenTerm, text: word}, end, nil
+	}
+	if value == "" && end < len(query) && query[end] == '"' {
+		quoted, next, err := readQuoted(query, end)
+		if err != nil {
+			return queryToken{}, 0, err
+		}
+		value, end = quoted, next
+	}
+	if value == "" {
+		return queryToken{}, 0, fmt.Errorf("%s: needs a value", field)
+	}
+	return queryToken{kind: tokenField, field: strings.ToLower(field), text: value}, end, nil
+}
+
+func isQueryField(field string) bool {
+	switch field {
+	case "from", "has", "mentions", "before", "after":
+		return true
+	}
+	return false
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *queryParser) parseOr() (messageFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	terms := orFilter{left}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind != tokenOr {
+			break
+		}
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, right)
+	}
+	if len(terms) == 1 {
+		return left, nil
+	}
+	return terms, nil
+}
+
+func (p *queryParser) parseAnd() (messageFilter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	terms := andFilter{left}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind == tokenOr || tok.kind == tokenClose {
+			break
+		}
+		if tok.kind == tokenAnd {
+			p.pos++
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, right)
+	}
+	if len(terms) == 1 {
+		return left, nil
+	}
+	return terms, nil
+}
+
+func (p *queryParser) parseUnary() (messageFilter, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, errors.New("unexpected end of query")
+	}
+	p.pos++
+	switch tok.kind {
+	case tokenNot:
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notFilter{inner: inner}, nil
+	case tokenOpen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if next, ok := p.peek(); !ok || next.kind != tokenClose {
+			return nil, errors.New("missing )")
+		}
+		p.pos++
+		return expr, nil
+	case tokenTerm, tokenPhrase:
+		return newWordFilter(tok.text)
+	case tokenField:
+		return newFieldFilter(tok.field, tok.text)
+	}
+	return nil, fmt.Errorf("unexpected %q", tok.text)
+}
+
+func newWordFilter(text string) (messageFilter, error) {
+	normalized := strings.ToLower(strings.Join(strings.Fields(text), " "))
+	prefix := strings.HasSuffix(normalized, "*")
+	normalized = strings.TrimSuffix(normalized, "*")
+	if normalized == "" {
+		return nil, errors.New("empty search term")
+	}
+	return wordFilter{text: normalized, prefix: prefix}, nil
+}
+
+func newFieldFilter(field, value string) (messageFilter, error) {
+	switch field {
+	case "from":
+		return fromFilter{strings.ToLower(value)}, nil
+	case "mentions":
+		return mentionsFilter(mentionID(value)), nil
+	case "has":
+		kind := strings.ToLower(value)
+		if !slices.Contains(hasKinds, kind) {
+			return nil, fmt.Errorf("has:%s is not one of %s", value, strings.Join(hasKinds, ", "))
+		}
+		return hasFilter(kind), nil
+	case "before", "after":
+		at, err := parseQueryTime(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%s: %w", field, value, err)
+		}
+		return timeFilter{at: at, before: field == "before"}, nil
+	}
+	return nil, fmt.Errorf("unknown field %s:", field)
+}
+
+// mentionID accepts a bare ID or any of Discord's mention forms: <@42>,
+// nickname mentions <@!42> and role mentions <@&42>.
+func mentionID(value string) string {
+	if id, ok := strings.CutPrefix(value, "<@"); ok {
+		id = strings.TrimPrefix(strings.TrimPrefix(id, "!"), "&")
+		return strings.TrimSuffix(id, ">")
+	}
+	return value
+}
+
+// parseQueryTime accepts RFC3339 timestamps or bare YYYY-MM-DD dates (UTC
+// midnight).
+func parseQueryTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return parseTimestamp(value)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseQueryMatches(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		// words, prefixes and phrases
+		{"breach", true},
+		{"BREACH", true},
+		{"epo", false},
+		{"epo*", true},
+		{"exploit", false},
+		{"exploit*", true},
+		{`"poc released"`, true},
+		{`"released poc"`, false},
+		{`"epoch 5 see"`, true},   // phrases match across line breaks
+		{"breach and poc", false}, // lower-case operators are plain words
+
+		// precedence: AND binds tighter than OR, adjacency is AND
+		{"missing OR breach AND poc", true},
+		{"breach OR missing nothing", true},
+		{"(breach OR missing) AND nothing", false},
+		{"(breach OR missing) poc", true},
+
+		// NOT
+		{"NOT missing", true},
+		{"NOT breach", false},
+		{"breach NOT poc", false},
+		{"NOT NOT breach", true},
+		{"NOT (missing OR nothing)", true},
+
+		// fields
+		{"from:alice", true},
+		{`from:"Alice Smith"`, true},
+		{"from:42", true},
+		{"from:bob", false},
+		{"has:attachment", true},
+		{"has:image", true},
+		{"has:file", false},
+		{"has:link", true},
+		{"has:reply", true},
+		{"has:mention", true},
+		{"has:reaction", false},
+		{"has:thread", false},
+		{"mentions:7", true},
+		{"mentions:<@7>", true},
+		{"mentions:<@!7>", true},
+		{"mentions:<@&8>", true},
+		{"mentions:9", false},
+		{"before:2025-03-11", true},
+		{"before:2025-03-10", false},
+		{"before:2025-03-10T12:00:00Z", false}, // before: is exclusive
+		{"after:2025-03-10T12:00:00Z", true},   // after: is inclusive
+		{"after:2025-03-11", false},
+		{"breach from:alice after:2025-01-01 NOT has:thread", true},
+	}
+
+	msg := newFilterMessage(&Message{
+		ID:             "1",
+		ChannelID:      "100",
+		Content:        "Breach PoC released; exploitation seen since epoch 5\nsee https://example.com/x",
+		Author:         Author{ID: "42", Username: "alice", DisplayName: "Alice Smith"},
+		Timestamp:      time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC),
+		MentionUserIDs: []string{"7"},
+		MentionRoleIDs: []string{"8"},
+		Attachments:    []Attachment{{ID: "a1", Filename: "shot.png"}},
+		ReplyTo:        &ReplyReference{MessageID: "0"},
+	})
+	for _, tt := range tests {
+		filter, err := parseQuery(tt.query)
+		if err != nil {
+			t.Errorf("parseQuery(%q): %v", tt.query, err)
+			continue
+		}
+		if got := filter.match(msg); got != tt.want {
+			t.Errorf("parseQuery(%q).match = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, query := range []string{
+		"",
+		"breach AND",
+		"NOT",
+		"OR breach",
+		"(breach",
+		"breach)",
+		"()",
+		`"unterminated`,
+		`from:"unterminated`,
+		"from:",
+		"has:nothing",
+		"before:yesterday",
+		"*",
+	} {
+		if _, err := parseQuery(query); err == nil {
+			t.Errorf("parseQuery(%q) succeeded, want an error", query)
+		}
+	}
+}
+
+func TestCompileFilterKeywords(t *testing.T) {
+	msg := &Message{
+		ID:      "1",
+		Content: "PoC   released\nexploit\tchain",
+		Author:  Author{ID: "42", Username: "alice"},
+	}
+
+	tests := []struct {
+		name string
+		opts scrapeOptions
+		want bool
+	}{
+		{"plain keyword", scrapeOptions{Keywords: []string{"poc"}}, true},
+		{"double space", scrapeOptions{Keywords: []string{"poc  released"}}, true},
+		{"line break", scrapeOptions{Keywords: []string{"released\nexploit"}}, true},
+		{"tab", scrapeOptions{Keywords: []string{"exploit chain"}}, true},
+		{"no match", scrapeOptions{Keywords: []string{"breach"}}, false},
+		{"user and keyword", scrapeOptions{Keywords: []string{"poc"}, Users: []string{"ALICE"}}, true},
+		{"other user", scrapeOptions{Keywords: []string{"poc"}, Users: []string{"bob"}}, false},
+		{"keyword and query", scrapeOptions{Keywords: []string{"poc"}, Query: "NOT from:alice"}, false},
+	}
+	for _, tt := range tests {
+		filter, err := compileFilter(&tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := filter.match(newFilterMessage(msg)); got != tt.want {
+			t.Errorf("%s: match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if filter, err := compileFilter(&scrapeOptions{}); err != nil || filter != nil {
+		t.Errorf("compileFilter with no filters = %v, %v; want nil, nil", filter, err)
+	}
+}
+
+func TestCompileFilterRegexAndExclusions(t *testing.T) {
+	msg := &Message{
+		ID:      "1",
+		Content: "Leaked creds for CORP\\admin\npassword: hunter2",
+		Author:  Author{ID: "42", Username: "alice", DisplayName: "Alice Smith"},
+	}
+
+	tests := []struct {
+		name string
+		opts scrapeOptions
+		want bool
+	}{
+		{"regex", scrapeOptions{Regexes: []string{`password: \w+`}}, true},
+		{"regex is case sensitive", scrapeOptions{Regexes: []string{`PASSWORD`}}, false},
+		{"regex case flag", scrapeOptions{Regexes: []string{`(?i)PASSWORD`}}, true},
+		{"regex sees line breaks", scrapeOptions{Regexes: []string{`admin password`}}, false},
+		{"any regex", scrapeOptions{Regexes: []string{`token`, `hunter\d`}}, true},
+		{"regex and keyword", scrapeOptions{Regexes: []string{`hunter\d`}, Keywords: []string{"ssh key"}}, false},
+		{"excluded keyword", scrapeOptions{ExcludeKeywords: []string{"HUNTER2"}}, false},
+		{"excluded keyword across whitespace", scrapeOptions{ExcludeKeywords: []string{"admin  password"}}, false},
+		{"other excluded keyword", scrapeOptions{ExcludeKeywords: []string{"ssh"}}, true},
+		{"keyword minus exclusion", scrapeOptions{Keywords: []string{"creds"}, ExcludeKeywords: []string{"hunter2"}}, false},
+		{"excluded user by name", scrapeOptions{ExcludeUsers: []string{"ALICE"}}, false},
+		{"excluded user by display name", scrapeOptions{ExcludeUsers: []string{"alice smith"}}, false},
+		{"excluded user by ID", scrapeOptions{ExcludeUsers: []string{"42"}}, false},
+		{"other excluded user", scrapeOptions{ExcludeUsers: []string{"bob"}}, true},
+	}
+	for _, tt := range tests {
+		filter, err := compileFilter(&tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := filter.match(newFilterMessage(msg)); got != tt.want {
+			t.Errorf("%s: match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := compileFilter(&scrapeOptions{Regexes: []string{`(unclosed`}}); err == nil {
+		t.Error("invalid --regex compiled without error")
+	}
+}
+
+func TestApplyContentFiltersRoundTrips(t *testing.T) {
+	opts := scrapeOptions{
+		Keywords:        []string{"breach"},
+		Users:           []string{"alice"},
+		Query:           "has:link",
+		Regexes:         []string{`CVE-\d+`},
+		ExcludeKeywords: []string{"test"},
+		ExcludeUsers:    []string{"bot"},
+	}
+	summary := newFilterSummary(&opts)
+
+	var restored scrapeOptions
+	applyContentFilters(&restored, &summary)
+	if !reflect.DeepEqual(restored, opts) {
+		t.Errorf("restored options = %+v, want %+v", restored, opts)
+	}
+}
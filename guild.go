@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// ScrapeGuild lists the guild's text channels and runs the regular channel
+// pipeline against each one, up to concurrency at a time. Channels the token
+// cannot read are recorded as skipped rather than aborting the sweep.
+// Sections are returned in channel position order, their messages spooled
+// into sp.
+func (c *DiscordClient) ScrapeGuild(ctx context.Context, opts *scrapeOptions, sp *spool, concurrency int) ([]ChannelExport, []SkippedChannel, Stats, error) {
+	var stats Stats
+	channels, metrics, err := c.listGuildChannels(ctx, opts.GuildID)
+	stats.addMetrics(metrics)
+	if err != nil {
+		return nil, nil, stats, fmt.Errorf("list guild channels: %w", err)
+	}
+
+	targets := make([]apiChannel, 0, len(channels))
+	for i := range channels {
+		ch := &channels[i]
+		if isTextChannel(ch.Type) || (opts.Threads && isForumChannel(ch.Type)) {
+			targets = append(targets, *ch)
+		}
+	}
+
+	sections, skipped, chStats, err := c.scrapeChannels(ctx, opts, sp, targets, concurrency)
+	stats.add(chStats)
+	return sections, skipped, stats, err
+}
+
+func (c *DiscordClient) listGuildChannels(ctx context.Context, guildID string) ([]apiChannel, batchMetrics, error) {
+	endpoint := fmt.Sprintf("%s/guilds/%s/channels", apiBase, guildID)
+	var channels []apiChannel
+	metrics, err := c.getJSON(ctx, endpoint, nil, &channels)
+	if err != nil {
+		return nil, metrics, err
+	}
+	sort.SliceStable(channels, func(i, j int) bool {
+		if channels[i].Position != channels[j].Position {
+			return channels[i].Position < channels[j].Position
+		}
+		return channels[i].ID < channels[j].ID
+	})
+	return channels, metrics, nil
+}
+
+func isTextChannel(channelType int) bool {
+	return channelType == channelTypeGuildText || channelType == channelTypeGuildAnnouncement
+}
@@ -7,6 +7,11 @@ const usageText = `
 
 Usage
   %s --channel <id> [flags]        Scrape a channel and export history
+  %s --guild <id> [flags]          Sweep every readable text channel in a guild
+  %s sync <export.json>            Fetch messages newer than an export and merge them in
+  %s query <export.json|dir>...    Search existing exports offline (--keyword/--user/--range/--days)
+  %s verify <manifest.json>        Re-hash a run's files and report any that changed (--pubkey checks signatures)
+  %s keygen                        Create the Ed25519 signing key used by --sign
   %s set-token <discord_token>     Store token in ~/.discord.env (mode 0600)
 
 Tokens
@@ -14,18 +19,41 @@ Tokens
   --token <value>                  Provide token explicitly (overrides env + file)
 
 Core Flags
-  --channel <id>                   REQUIRED. Channel ID to scrape
+  --channel <id>                   Channel ID to scrape (repeatable/comma-separated; required unless --guild)
+  --concurrency <n>                Channels scraped (and attachments downloaded) in parallel (default 4)
+  --guild <id>                     Sweep all text channels in a guild (skips unreadable ones)
   --days <n>                       Relative days window (required if --hours absent)
   --hours <n>                      Relative hours window (required if --days absent)
   --range start,end                Absolute RFC3339 window, e.g. 2025-01-01T00:00:00Z,2025-01-02T00:00:00Z
   --keyword <text>                 Case-insensitive substring filter (repeatable, OR-matched)
   --user <name|id>                 Filter by username, display name, or user ID (repeatable)
+  --query <expr>                   Boolean filter: AND/OR/NOT, (...), "phrases", whole words
+                                   (poc* for prefixes), from:, has:, mentions:, before:, after:
+  --regex <re>                     Go regular expression on message content (repeatable, OR-matched)
+  --exclude-keyword <text>         Drop messages containing this substring (repeatable)
+  --exclude-user <name|id>         Drop messages from this author (repeatable)
+  --include-bots                   Keep bot and webhook messages too (skipped by default)
+  --only-bots                      Keep only bot and webhook messages (alert feeds, RSS relays)
+  --type <name|n>                  Keep only these message types (repeatable): default, reply, join, pin,
+                                   boost, thread-created, slash-command, ... or "system" for every event
+  --threads                        Include active/archived threads and forum posts
 
 Output
-  --format json|markdown|both      Export format (default json; "md" accepted as alias)
-  --output <prefix>                Filename prefix (default discord_<channel>_<ts>)
+  --format json|markdown|both|ndjson|csv|tsv|html|sqlite|stix|misp
+                                   Export format (default json; "md" and "jsonl" accepted as aliases)
+  --output <prefix>                Filename prefix (default discord_<channel>_<ts>); "-" streams ndjson to stdout
+  --columns <a,b,...>              CSV/TSV columns to write, in order (default all)
+  --ndjson-meta                    Header/trailer lines with filters and stats around NDJSON (default true)
+  --split                          With --guild or several channels, one file per channel plus <prefix>_index.json
   --max <n>                        Stop after N messages (0 = unlimited)
   --quiet                          Suppress progress output (errors still print)
+  --resume <file>                  Continue a failed scrape from <prefix>.checkpoint.json
+  --extract-indicators             Pull URLs, domains, IPs, hashes, CVEs, emails, BTC/ETH addresses into
+                                   each message and an "indicators" summary (defanged text is refanged)
+  --indicators-file json|csv       Also write the summary to <prefix>_indicators.json or .csv
+  --download-attachments           Save attachments to <prefix>_files/ and record their SHA-256
+  --max-attachment-mb <n>          Skip attachments larger than n MiB when downloading (default 25, 0 = no limit)
+  --sign                           Write a detached <file>.sig for every output and the manifest (run keygen first)
 
 Examples
   # Pull last seven days of history into JSON
@@ -34,12 +62,69 @@ Examples
   # Filter by keywords and export Markdown
   %s --channel 123 --keyword breach --keyword poc --format markdown
 
+  # Pipe messages straight into jq
+  %s --channel 123 --days 1 --format ndjson --output - --ndjson-meta=false | jq -r .content
+
+  # Search every export in a folder and save the hits as Markdown
+  %s query --keyword breach --days 30 --output hits --format markdown ./exports
+
+  # Sweep a whole server into per-channel files
+  %s --guild 456 --days 1 --split
+
+  # Check that an export has not been altered since it was written
+  %s verify discord_123_20250101T000000Z_manifest.json
+
+  # Sign exports, then check them against the shared public key
+  %s keygen
+  %s --channel 123 --days 1 --sign
+  %s verify --pubkey ed25519.key.pub discord_123_20250101T000000Z_manifest.json
+
   # Set token once and reuse automatically
   %s set-token $DISCORD_TOKEN
 
 Notes
   • set-token writes ~/.discord.env (mode 0600) — no shell sourcing required.
-  • Bot messages are always skipped automatically.
-  • Output files land in the current working directory.
+  • Bot and webhook messages are skipped unless --include-bots or --only-bots is set;
+    exports mark them with author.bot or author.webhook.
+  • Output files land in the current working directory, with a <prefix>_manifest.json
+    recording each file's SHA-256 and size, the version, operator, host, command
+    line (tokens redacted) and filters. verify exits non-zero if any file changed.
+  • keygen stores the key pair in your config dir (e.g. ~/.config/ripcord/ed25519.key
+    and ed25519.key.pub); signatures are Ed25519ph over the file's SHA-512 digest.
+  • Ctrl-C stops the scrape and writes what was collected, marked "partial": true;
+    press it again to quit immediately.
+  • --query terms match whole words case-insensitively; adjacent terms are AND-ed and
+    operators must be upper case. has: takes attachment, image, file, link, embed,
+    reaction, reply, mention or thread; before:/after: take YYYY-MM-DD or RFC3339
+    (before: is exclusive, after: inclusive). --keyword/--user still apply alongside it.
+  • Keyword, --query and --regex filters also search embed text (titles, descriptions,
+    fields, footers), so bot-relayed feeds that post only embeds still match.
+  • System events (joins, pins, boosts, new threads) usually have no text and are
+    dropped with other empty messages; naming them with --type keeps them, and
+    Markdown renders each as a single italic line tagged with its type.
+  • Indicator summaries list each value once with its count and the first and last
+    message that mentioned it; "defanged": true marks values written as hxxp://, [.], etc.
+  • --regex is case-sensitive unless the pattern starts with (?i); exclusions always
+    win over the include filters.
+  • Attachment URLs are signed and expire; --download-attachments keeps local copies and
+    points Markdown and HTML links at them. Failed or oversized files keep their
+    original URL and get a download_error instead.
+  • html writes one offline page with a chat-style transcript, search box and
+    author/date filters; attachment thumbnails load from Discord's CDN.
+  • sqlite appends to <prefix>.sqlite across runs without duplicating messages and
+    keeps a full-text index (messages_fts) over message content.
+  • stix writes a STIX 2.1 bundle to <prefix>.stix.json: a note per message, an
+    identity per author, indicators for extracted observables and a report
+    carrying the channel and filters. IDs are stable across re-exports.
+  • misp writes one MISP event to <prefix>.misp.json: a link per message, a
+    filename|sha256 per downloaded attachment and an attribute per indicator,
+    tagged with the --keyword values that matched.
+  • csv/tsv also write <prefix>_attachments and <prefix>_reactions tables keyed by
+    message_id; columns: id, timestamp, edited_timestamp, channel_id, parent_channel_id,
+    thread_name, author_id, author_username, author_display_name, author_bot,
+    author_webhook, content, type, reply_to_message_id, reply_to_author_id,
+    mention_user_ids, mention_role_ids, attachment_count, reaction_count, embed_count.
+  • Single-channel scrapes checkpoint progress to <prefix>.checkpoint.json; it is
+    removed once the export is written.
 
 `
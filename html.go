@@ -0,0 +1,513 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// htmlPage is the export-level data shown above the transcript.
+type htmlPage struct {
+	Title   string
+	Details []string
+}
+
+type htmlSection struct {
+	Heading string
+	Thread  bool
+}
+
+type htmlGroup struct {
+	AuthorName string
+	Username   string
+	Initial    string
+	Bot        bool
+	Webhook    bool
+	Time       string
+}
+
+type htmlMessage struct {
+	ID          string
+	AuthorID    string
+	AuthorName  string
+	TimestampMS int64
+	Time        string
+	Edited      bool
+	Content     string
+	Reply       *htmlReply
+	Attachments []htmlAttachment
+	Reactions   []Reaction
+	EmbedCount  int
+}
+
+type htmlReply struct {
+	MessageID string
+	Author    string
+	Snippet   string
+	Found     bool
+}
+
+type htmlAttachment struct {
+	Filename string
+	URL      string
+	Size     string
+	Image    bool
+}
+
+// htmlTemplates renders the transcript piece by piece so messages can be
+// streamed from the spool. html/template escapes every user-controlled
+// string and neutralizes unsafe URLs in href/src.
+var htmlTemplates = template.Must(template.New("html").Parse(htmlTemplateText))
+
+// htmlWriter tracks the author group currently open while streaming
+// messages, and remembers recent messages for reply previews.
+type htmlWriter struct {
+	w       io.Writer
+	open    bool
+	last    *Message
+	replies *replyCache
+}
+
+func writeHTML(path string, export *Export) (err error) {
+	file, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := file.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	w := bufio.NewWriter(file)
+	hw := &htmlWriter{w: w, replies: newReplyCache(htmlReplyCacheSize)}
+	if err := htmlTemplates.ExecuteTemplate(w, "head", newHTMLPage(export)); err != nil {
+		return err
+	}
+
+	if export.ChannelID == "" {
+		for i := range export.Channels {
+			section := &export.Channels[i]
+			heading := fmt.Sprintf("#%s (%s) — %d messages", section.Name, section.ChannelID, section.MessageCount)
+			if section.Partial {
+				heading += " — partial"
+			}
+			if err := hw.section(heading, false); err != nil {
+				return err
+			}
+			if err := hw.messages(section.messages()); err != nil {
+				return err
+			}
+		}
+	} else if err := hw.messages(export.messages()); err != nil {
+		return err
+	}
+
+	if err := hw.closeGroup(); err != nil {
+		return err
+	}
+	if err := htmlTemplates.ExecuteTemplate(w, "foot", nil); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func newHTMLPage(export *Export) htmlPage {
+	page := htmlPage{}
+	switch {
+	case export.ChannelID != "":
+		page.Title = "Discord export for channel " + export.ChannelID
+	case export.GuildID != "":
+		page.Title = "Discord export for guild " + export.GuildID
+	default:
+		page.Title = "Discord export for multiple channels"
+	}
+
+	page.Details = append(page.Details,
+		"Exported "+export.ExportedAt.Format(time.RFC3339),
+		fmt.Sprintf("%d messages", export.MessageCount))
+	if export.Partial {
+		page.Details = append(page.Details, "Partial: interrupted"+stoppedSuffix(export.StoppedBefore))
+	}
+	if f := export.Filters; f.Since != nil {
+		page.Details = append(page.Details, "Since "+f.Since.Format(time.RFC3339))
+	}
+	if f := export.Filters; f.Until != nil {
+		page.Details = append(page.Details, "Until "+f.Until.Format(time.RFC3339))
+	}
+	if len(export.Filters.Keywords) > 0 {
+		page.Details = append(page.Details, "Keywords: "+strings.Join(export.Filters.Keywords, ", "))
+	}
+	if len(export.Filters.Users) > 0 {
+		page.Details = append(page.Details, "Users: "+strings.Join(export.Filters.Users, ", "))
+	}
+	if export.Filters.Query != "" {
+		page.Details = append(page.Details, "Query: "+export.Filters.Query)
+	}
+	if len(export.Filters.Regexes) > 0 {
+		page.Details = append(page.Details, "Regex: "+strings.Join(export.Filters.Regexes, ", "))
+	}
+	if len(export.Filters.ExcludeKeywords) > 0 {
+		page.Details = append(page.Details, "Excluded keywords: "+strings.Join(export.Filters.ExcludeKeywords, ", "))
+	}
+	if len(export.Filters.ExcludeUsers) > 0 {
+		page.Details = append(page.Details, "Excluded users: "+strings.Join(export.Filters.ExcludeUsers, ", "))
+	}
+	if export.Filters.Bots != "" {
+		page.Details = append(page.Details, "Bots and webhooks: "+export.Filters.Bots)
+	}
+	if len(export.Filters.Types) > 0 {
+		page.Details = append(page.Details, "Message types: "+strings.Join(export.Filters.Types, ", "))
+	}
+	return page
+}
+
+// messages renders a channel's own messages, then each thread under its own
+// heading, mirroring the Markdown layout.
+func (hw *htmlWriter) messages(src messageSource) error {
+	groups := src.groups()
+	if err := drain(groups[0], hw.message); err != nil {
+		return err
+	}
+	for _, group := range groups[1:] {
+		first := true
+		err := drain(group, func(msg *Message) error {
+			if first {
+				first = false
+				if err := hw.section(fmt.Sprintf("Thread: %s (%s)", msg.ThreadName, msg.ChannelID), true); err != nil {
+					return err
+				}
+			}
+			return hw.message(msg)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (hw *htmlWriter) section(heading string, thread bool) error {
+	if err := hw.closeGroup(); err != nil {
+		return err
+	}
+	hw.last = nil
+	return htmlTemplates.ExecuteTemplate(hw.w, "section", htmlSection{Heading: heading, Thread: thread})
+}
+
+// message renders msg, starting a new author group unless it continues the
+// previous author's run within htmlGroupWindow.
+func (hw *htmlWriter) message(msg *Message) error {
+	if !hw.continuesGroup(msg) {
+		if err := hw.closeGroup(); err != nil {
+			return err
+		}
+		name := authorName(&msg.Author)
+		group := htmlGroup{
+			AuthorName: name,
+			Username:   msg.Author.Username,
+			Initial:    strings.ToUpper(firstRune(name)),
+			Bot:        msg.Author.Bot,
+			Webhook:    msg.Author.Webhook,
+			Time:       msg.Timestamp.UTC().Format("2006-01-02 15:04 MST"),
+		}
+		if err := htmlTemplates.ExecuteTemplate(hw.w, "groupStart", group); err != nil {
+			return err
+		}
+		hw.open = true
+	}
+
+	last := *msg
+	hw.last = &last
+	hw.replies.add(msg)
+	return htmlTemplates.ExecuteTemplate(hw.w, "message", hw.htmlMessage(msg))
+}
+
+func (hw *htmlWriter) continuesGroup(msg *Message) bool {
+	if !hw.open || hw.last == nil || msg.ReplyTo != nil {
+		return false
+	}
+	return hw.last.Author.ID == msg.Author.ID &&
+		hw.last.Author.Username == msg.Author.Username &&
+		msg.Timestamp.Sub(hw.last.Timestamp) < htmlGroupWindow
+}
+
+func (hw *htmlWriter) closeGroup() error {
+	if !hw.open {
+		return nil
+	}
+	hw.open = false
+	return htmlTemplates.ExecuteTemplate(hw.w, "groupEnd", nil)
+}
+
+func (hw *htmlWriter) htmlMessage(msg *Message) htmlMessage {
+	out := htmlMessage{
+		ID:          msg.ID,
+		AuthorID:    msg.Author.ID,
+		AuthorName:  authorName(&msg.Author),
+		TimestampMS: msg.Timestamp.UnixMilli(),
+		Time:        msg.Timestamp.UTC().Format(time.RFC3339),
+		Edited:      msg.EditedTimestamp != nil,
+		Content:     msg.Content,
+		Reactions:   msg.Reactions,
+		EmbedCount:  msg.EmbedCount,
+	}
+	if msg.ReplyTo != nil {
+		out.Reply = hw.replies.preview(msg.ReplyTo)
+	}
+	for i := range msg.Attachments {
+		att := &msg.Attachments[i]
+		url := att.URL
+		if att.LocalPath != "" {
+			url = att.LocalPath
+		}
+		out.Attachments = append(out.Attachments, htmlAttachment{
+			Filename: att.Filename,
+			URL:      url,
+			Size:     formatSize(att.Size),
+			Image:    isImageAttachment(att),
+		})
+	}
+	return out
+}
+
+func authorName(author *Author) string {
+	if author.DisplayName != "" {
+		return author.DisplayName
+	}
+	if author.Username != "" {
+		return author.Username
+	}
+	return author.ID
+}
+
+func firstRune(s string) string {
+	for _, r := range s {
+		return string(r)
+	}
+	return "?"
+}
+
+func isImageAttachment(att *Attachment) bool {
+	if strings.HasPrefix(att.ContentType, "image/") {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(att.Filename)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp":
+		return true
+	}
+	return false
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size <= 0:
+		return ""
+	case size < 1024:
+		return fmt.Sprintf("%d B", size)
+	case size < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	}
+	return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+}
+
+// replyCache remembers the last few thousand messages so replies can show a
+// preview of what they answer without holding the whole channel in memory.
+type replyCache struct {
+	entries map[string]htmlReply
+	ring    []string
+	next    int
+}
+
+func newReplyCache(size int) *replyCache {
+	return &replyCache{entries: make(map[string]htmlReply, size), ring: make([]string, size)}
+}
+
+func (c *replyCache) add(msg *Message) {
+	if old := c.ring[c.next]; old != "" {
+		delete(c.entries, old)
+	}
+	c.ring[c.next] = msg.ID
+	c.next = (c.next + 1) % len(c.ring)
+
+	snippet := []rune(strings.Join(strings.Fields(msg.Content), " "))
+	if len(snippet) > htmlReplySnippetLen {
+		snippet = append(snippet[:htmlReplySnippetLen], '…')
+	}
+	c.entries[msg.ID] = htmlReply{
+		MessageID: msg.ID,
+		Author:    authorName(&msg.Author),
+		Snippet:   string(snippet),
+		Found:     true,
+	}
+}
+
+func (c *replyCache) preview(ref *ReplyReference) *htmlReply {
+	if reply, ok := c.entries[ref.MessageID]; ok {
+		return &reply
+	}
+	return &htmlReply{MessageID: ref.MessageID, Author: ref.AuthorID}
+}
+
+const htmlTemplateText = `
+{{- define "head" -}}
+<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+:root { --bg: #313338; --panel: #2b2d31; --text: #dbdee1; --muted: #949ba4; --accent: #5865f2; --pill: #3f4147; }
+* { box-sizing: border-box; }
+body { margin: 0; background: var(--bg); color: var(--text); font: 15px/1.4 "gg sans", "Helvetica Neue", Helvetica, Arial, sans-serif; }
+header { position: sticky; top: 0; z-index: 1; background: var(--panel); padding: 12px 20px; border-bottom: 1px solid #1e1f22; }
+header h1 { margin: 0 0 4px; font-size: 18px; }
+header .details { color: var(--muted); font-size: 13px; }
+header .details span + span::before { content: " · "; }
+.toolbar { display: flex; flex-wrap: wrap; gap: 8px; margin-top: 10px; align-items: center; }
+.toolbar input, .toolbar select { background: #1e1f22; color: var(--text); border: 1px solid #1e1f22; border-radius: 4px; padding: 6px 8px; font: inherit; }
+.toolbar input[type=search] { flex: 1 1 240px; }
+.toolbar .count { color: var(--muted); font-size: 13px; }
+main { padding: 8px 20px 40px; }
+h2.section { margin: 24px 0 8px; font-size: 16px; color: var(--muted); border-bottom: 1px solid #3f4147; padding-bottom: 4px; }
+h2.section.thread { font-size: 14px; margin-left: 56px; }
+.group { display: flex; gap: 16px; padding: 8px 0 2px; }
+.avatar { flex: 0 0 40px; height: 40px; border-radius: 50%; background: var(--accent); color: #fff; display: flex; align-items: center; justify-content: center; font-weight: 600; }
+.body { flex: 1; min-width: 0; }
+.meta .name { font-weight: 600; color: #f2f3f5; }
+.meta .user, .meta .time { color: var(--muted); font-size: 12px; margin-left: 6px; }
+.badge { background: var(--accent); color: #fff; border-radius: 3px; font-size: 10px; padding: 1px 4px; margin-left: 6px; vertical-align: middle; }
+.message { padding: 2px 0; }
+.message:target { background: #3f4147; }
+.content { white-space: pre-wrap; overflow-wrap: anywhere; }
+.edited { color: var(--muted); font-size: 11px; margin-left: 4px; }
+.reply { color: var(--muted); font-size: 13px; border-left: 2px solid #4e5058; padding-left: 8px; margin: 2px 0; }
+.reply a { color: var(--muted); text-decoration: none; }
+.reply b { color: var(--text); }
+.attachments { display: flex; flex-wrap: wrap; gap: 8px; margin: 4px 0; }
+.attachments img { max-width: 320px; max-height: 240px; border-radius: 4px; display: block; }
+.attachments a { color: #00a8fc; }
+.reactions { display: flex; flex-wrap: wrap; gap: 4px; margin: 4px 0; }
+.reaction { background: var(--pill); border-radius: 8px; padding: 1px 8px; font-size: 13px; }
+.embeds { color: var(--muted); font-size: 12px; }
+.hidden { display: none !important; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Title}}</h1>
+<div class="details">{{range .Details}}<span>{{.}}</span>{{end}}</div>
+<div class="toolbar">
+<input type="search" id="q" placeholder="Search messages" aria-label="Search messages">
+<select id="author" aria-label="Filter by author"><option value="">All authors</option></select>
+<label>From <input type="date" id="from"></label>
+<label>To <input type="date" id="to"></label>
+<span class="count" id="count"></span>
+</div>
+</header>
+<main>
+{{end}}
+
+{{- define "section"}}
+<h2 class="section{{if .Thread}} thread{{end}}">{{.Heading}}</h2>
+{{- end}}
+
+{{- define "groupStart"}}
+<div class="group">
+<div class="avatar" aria-hidden="true">{{.Initial}}</div>
+<div class="body">
+<div class="meta"><span class="name">{{.AuthorName}}</span>{{if .Webhook}}<span class="badge">WEBHOOK</span>{{else if .Bot}}<span class="badge">BOT</span>{{end}}{{if and .Username (ne .Username .AuthorName)}}<span class="user">{{.Username}}</span>{{end}}<span class="time">{{.Time}}</span></div>
+{{- end}}
+
+{{- define "message"}}
+<div class="message" id="m{{.ID}}" data-author="{{.AuthorID}}" data-name="{{.AuthorName}}" data-ts="{{.TimestampMS}}">
+{{- with .Reply}}
+<div class="reply">↪ <a href="#m{{.MessageID}}">{{if .Found}}<b>{{.Author}}</b> {{.Snippet}}{{else}}replying to message {{.MessageID}}{{if .Author}} by {{.Author}}{{end}} (not in this export){{end}}</a></div>
+{{- end}}
+<div class="content" title="{{.Time}}">{{.Content}}{{if .Edited}}<span class="edited">(edited)</span>{{end}}</div>
+{{- if .Attachments}}
+<div class="attachments">{{range .Attachments}}{{if .Image}}<a href="{{.URL}}" title="{{.Filename}}"><img src="{{.URL}}" alt="{{.Filename}}" loading="lazy"></a>{{else}}<a href="{{.URL}}">📎 {{.Filename}}</a>{{end}}{{if .Size}} <span class="edited">{{.Size}}</span>{{end}}{{end}}</div>
+{{- end}}
+{{- if .Reactions}}
+<div class="reactions">{{range .Reactions}}<span class="reaction">{{.Emoji}} {{.Count}}</span>{{end}}</div>
+{{- end}}
+{{- if .EmbedCount}}
+<div class="embeds">{{.EmbedCount}} embed(s)</div>
+{{- end}}
+</div>
+{{- end}}
+
+{{- define "groupEnd"}}
+</div>
+</div>
+{{- end}}
+
+{{- define "foot"}}
+</main>
+<script>
+(function () {
+  var messages = Array.prototype.slice.call(document.querySelectorAll(".message"));
+  var groups = Array.prototype.slice.call(document.querySelectorAll(".group"));
+  var q = document.getElementById("q");
+  var author = document.getElementById("author");
+  var from = document.getElementById("from");
+  var to = document.getElementById("to");
+  var count = document.getElementById("count");
+
+  var authors = {};
+  messages.forEach(function (m) {
+    m._text = m.textContent.toLowerCase();
+    authors[m.dataset.author] = m.dataset.name;
+  });
+  Object.keys(authors).sort(function (a, b) {
+    return authors[a].localeCompare(authors[b]);
+  }).forEach(function (id) {
+    var opt = document.createElement("option");
+    opt.value = id;
+    opt.textContent = authors[id];
+    author.appendChild(opt);
+  });
+
+  function day(input, endOfDay) {
+    if (!input.value) return null;
+    var t = Date.parse(input.value + "T00:00:00Z");
+    return endOfDay ? t + 86400000 : t;
+  }
+
+  function apply() {
+    var needle = q.value.trim().toLowerCase();
+    var who = author.value;
+    var start = day(from, false);
+    var end = day(to, true);
+    var shown = 0;
+    messages.forEach(function (m) {
+      var ts = Number(m.dataset.ts);
+      var ok = (!needle || m._text.indexOf(needle) !== -1) &&
+        (!who || m.dataset.author === who) &&
+        (start === null || ts >= start) &&
+        (end === null || ts < end);
+      m.classList.toggle("hidden", !ok);
+      if (ok) shown++;
+    });
+    groups.forEach(function (g) {
+      g.classList.toggle("hidden", !g.querySelector(".message:not(.hidden)"));
+    });
+    count.textContent = shown + " of " + messages.length + " messages";
+  }
+
+  [q, author, from, to].forEach(function (el) {
+    el.addEventListener("input", apply);
+  });
+  apply();
+})();
+</script>
+</body>
+</html>
+{{end}}
+`
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Indicator is one observable found in a message. Value is normalized and
+// refanged ("hxxp://evil[.]com" becomes "http://evil.com"); Defanged records
+// that the message wrote it defanged.
+type Indicator struct {
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	Defanged bool   `json:"defanged,omitempty"`
+}
+
+// IndicatorSummary aggregates one indicator across an export, with the first
+// and last messages (by timestamp) that mentioned it.
+type IndicatorSummary struct {
+	Type        string    `json:"type"`
+	Value       string    `json:"value"`
+	Count       int       `json:"count"`
+	FirstSeenID string    `json:"first_seen_message_id"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenID  string    `json:"last_seen_message_id"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+// Indicator types, in the order extractIndicators reports them.
+const (
+	indicatorURL     = "url"
+	indicatorDomain  = "domain"
+	indicatorIPv4    = "ipv4"
+	indicatorIPv6    = "ipv6"
+	indicatorEmail   = "email"
+	indicatorMD5     = "md5"
+	indicatorSHA1    = "sha1"
+	indicatorSHA256  = "sha256"
+	indicatorSHA512  = "sha512"
+	indicatorCVE     = "cve"
+	indicatorBitcoin = "btc"
+	indicatorEther   = "eth"
+)
+
+var (
+	// refangPatterns undo the usual ways analysts defang indicators so they
+	// cannot be clicked: hxxp, [.], (dot), [@], [:] and friends.
+	refangPatterns = []struct {
+		re   *regexp.Regexp
+		repl string
+	}{
+		{regexp.MustCompile(`(?i)\bh(?:xx|\*\*)ps(?:\[://\]|\[?:\]?//)`), "https://"},
+		{regexp.MustCompile(`(?i)\bh(?:xx|\*\*)p(?:\[://\]|\[?:\]?//)`), "http://"},
+		{regexp.MustCompile(`(?i)\bfxp(?:\[://\]|\[?:\]?//)`), "ftp://"},
+		{regexp.MustCompile(`(?i)\s?(?:\[\.\]|\(\.\)|\{\.\}|\[dot\]|\(dot\)|\{dot\})\s?`), "."},
+		{regexp.MustCompile(`(?i)\s?(?:\[@\]|\(@\)|\[at\]|\(at\))\s?`), "@"},
+		{regexp.MustCompile(`\[:\]`), ":"},
+	}
+
+	urlPattern     = regexp.MustCompile(`(?i)\b(?:https?|ftp)://[^\s<>"'` + "`" + `]+`)
+	domainPattern  = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,24}\b`)
+	ipv4Pattern    = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	ipv6Pattern    = regexp.MustCompile(`(?i)(?:^|[^0-9a-f:])((?:[0-9a-f]{0,4}:){2,7}[0-9a-f]{0,4})`)
+	emailPattern   = regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@(?:[a-z0-9-]+\.)+[a-z]{2,24}\b`)
+	hashPattern    = regexp.MustCompile(`(?i)\b[0-9a-f]{32,128}\b`)
+	cvePattern     = regexp.MustCompile(`(?i)\bCVE-\d{4}-\d{4,7}\b`)
+	bitcoinPattern = regexp.MustCompile(`\b(?:[13][a-km-zA-HJ-NP-Z1-9]{25,34}|bc1[ac-hj-np-z02-9]{11,71})\b`)
+	etherPattern   = regexp.MustCompile(`\b0x[0-9a-fA-F]{40}\b`)
+
+	// fileExtensions look like TLDs but are almost always filenames
+	// ("payload.exe") when they appear without a URL scheme.
+	fileExtensions = map[string]struct{}{
+		"bat": {}, "bin": {}, "cfg": {}, "conf": {}, "cpp": {}, "csv": {}, "dat": {}, "db": {}, "dll": {},
+		"doc": {}, "docx": {}, "elf": {}, "exe": {}, "gif": {}, "gz": {}, "htm": {}, "html": {}, "ini": {},
+		"jar": {}, "jpeg": {}, "jpg": {}, "js": {}, "json": {}, "log": {}, "md": {}, "msi": {}, "pdf": {},
+		"php": {}, "png": {}, "ps": {}, "py": {}, "rar": {}, "rb": {}, "sh": {}, "so": {}, "sql": {},
+		"svg": {}, "sys": {}, "tar": {}, "tmp": {}, "ts": {}, "txt": {}, "vbs": {}, "xls": {}, "xlsx": {},
+		"xml": {}, "yaml": {}, "yml": {}, "zip": {},
+	}
+
+	hashTypes = map[int]string{32: indicatorMD5, 40: indicatorSHA1, 64: indicatorSHA256, 128: indicatorSHA512}
+)
+
+// extractIndicators finds the observables in a message's content and embed
+// text, each reported once.
+func extractIndicators(msg *Message) []Indicator {
+	raw := messageText(msg)
+	text := refang(raw)
+	x := indicatorSet{original: strings.ToLower(raw), seen: make(map[string]struct{})}
+
+	for _, u := range urlPattern.FindAllString(text, -1) {
+		u = strings.TrimRight(u, ".,;:!?)]}'\"")
+		x.add(indicatorURL, u)
+		if host := urlHost(u); host != "" {
+			x.addHost(host)
+		}
+	}
+	for _, e := range emailPattern.FindAllString(text, -1) {
+		x.add(indicatorEmail, strings.ToLower(e))
+		x.addHost(e[strings.LastIndexByte(e, '@')+1:])
+	}
+	// Bare hostnames are only looked for outside URLs and email addresses,
+	// where paths ("repo/v1.tar") and local parts ("john.smith@") would
+	// otherwise read as domains.
+	bare := emailPattern.ReplaceAllString(urlPattern.ReplaceAllString(text, " "), " ")
+	for _, d := range domainPattern.FindAllString(bare, -1) {
+		x.addHost(d)
+	}
+	// Out-of-range octets ("10.0.0.300") match the pattern but are not
+	// addresses, and must not fall through to addHost as hostnames. Four
+	// numbers inside a longer dotted run are a version string.
+	for _, m := range ipv4Pattern.FindAllStringIndex(text, -1) {
+		if inDottedRun(text, m[0], m[1]) {
+			continue
+		}
+		if addr, err := netip.ParseAddr(text[m[0]:m[1]]); err == nil {
+			x.addMatched(indicatorIPv4, addr.String(), text[m[0]:m[1]])
+		}
+	}
+	for _, m := range ipv6Pattern.FindAllStringSubmatchIndex(text, -1) {
+		if candidate := text[m[2]:m[3]]; plausibleIPv6(candidate, text[m[3]:]) {
+			x.addHost(candidate)
+		}
+	}
+	for _, h := range hashPattern.FindAllString(text, -1) {
+		if kind, ok := hashTypes[len(h)]; ok {
+			x.add(kind, strings.ToLower(h))
+		}
+	}
+	for _, c := range cvePattern.FindAllString(text, -1) {
+		x.add(indicatorCVE, strings.ToUpper(c))
+	}
+	for _, addr := range bitcoinPattern.FindAllString(text, -1) {
+		if strings.HasPrefix(addr, "bc1") || validBase58Check(addr) {
+			x.add(indicatorBitcoin, addr)
+		}
+	}
+	for _, addr := range etherPattern.FindAllString(text, -1) {
+		x.add(indicatorEther, strings.ToLower(addr))
+	}
+	return x.found
+}
+
+func refang(text string) string {
+	for _, p := range refangPatterns {
+		text = p.re.ReplaceAllString(text, p.repl)
+	}
+	return text
+}
+
+// indicatorSet collects a message's indicators without duplicates, marking
+// values that only appear once the text is refanged.
+type indicatorSet struct {
+	original string
+	seen     map[string]struct{}
+	found    []Indicator
+}
+
+func (x *indicatorSet) add(kind, value string) {
+	x.addMatched(kind, value, value)
+}
+
+// addMatched records value, judging whether it was defanged by the text it
+// was matched as, which differs from value once an address is normalized
+// ("2001:db8:0:0::1" becomes "2001:db8::1").
+func (x *indicatorSet) addMatched(kind, value, matched string) {
+	key := kind + "\x00" + value
+	if _, dup := x.seen[key]; dup {
+		return
+	}
+	x.seen[key] = struct{}{}
+	x.found = append(x.found, Indicator{
+		Type:     kind,
+		Value:    value,
+		Defanged: !strings.Contains(x.original, strings.ToLower(matched)),
+	})
+}
+
+// addHost records a URL host or bare hostname as an IP address or domain.
+func (x *indicatorSet) addHost(host string) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if addr.Is4() {
+			x.addMatched(indicatorIPv4, addr.String(), host)
+		} else {
+			x.addMatched(indicatorIPv6, addr.String(), host)
+		}
+		return
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	tld := host[strings.LastIndexByte(host, '.')+1:]
+	if _, isFile := fileExtensions[tld]; isFile || !strings.Contains(host, ".") {
+		return
+	}
+	// No TLD is numeric, so "999.1.1.1" is a malformed address, not a name.
+	if strings.Trim(tld, "0123456789") == "" {
+		return
+	}
+	x.add(indicatorDomain, host)
+}
+
+// inDottedRun reports whether text[start:end] continues into more dotted
+// numbers on either side.
+func inDottedRun(text string, start, end int) bool {
+	digit := func(c byte) bool { return c >= '0' && c <= '9' }
+	return start >= 2 && text[start-1] == '.' && digit(text[start-2]) ||
+		end+1 < len(text) && text[end] == '.' && digit(text[end+1])
+}
+
+// plausibleIPv6 filters ipv6Pattern candidates: "::" alone, clock times and
+// C++ scopes ("std::vector") all parse or nearly parse as addresses, so at
+// least three groups must be present and the match must end on a boundary.
+func plausibleIPv6(candidate, rest string) bool {
+	if rest != "" {
+		if r := rest[0]; r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return false
+		}
+	}
+	groups := 0
+	for _, g := range strings.Split(candidate, ":") {
+		if g != "" {
+			groups++
+		}
+	}
+	addr, err := netip.ParseAddr(candidate)
+	return err == nil && addr.Is6() && groups >= 3
+}
+
+// urlHost returns the host part of a URL without port or credentials.
+func urlHost(u string) string {
+	rest := u[strings.Index(u, "://")+3:]
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		rest = rest[:i]
+	}
+	if i := strings.LastIndexByte(rest, '@'); i >= 0 {
+		rest = rest[i+1:]
+	}
+	if strings.HasPrefix(rest, "[") {
+		if i := strings.IndexByte(rest, ']'); i > 0 {
+			return rest[1:i]
+		}
+	}
+	if i := strings.LastIndexByte(rest, ':'); i >= 0 {
+		rest = rest[:i]
+	}
+	return rest
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// validBase58Check verifies a legacy Bitcoin address's checksum, which rules
+// out the random identifiers that happen to fit the address alphabet.
+func validBase58Check(addr string) bool {
+	n := new(big.Int)
+	for _, r := range addr {
+		i := strings.IndexRune(base58Alphabet, r)
+		if i < 0 {
+			return false
+		}
+		n.Mul(n, big.NewInt(58))
+		n.Add(n, big.NewInt(int64(i)))
+	}
+	decoded := n.Bytes()
+	for _, r := range addr {
+		if r != '1' {
+			break
+		}
+		decoded = append([]byte{0}, decoded...)
+	}
+	if len(decoded) != 25 {
+		return false
+	}
+	first := sha256.Sum256(decoded[:21])
+	second := sha256.Sum256(first[:])
+	return slices.Equal(second[:4], decoded[21:])
+}
+
+// summarizeIndicators extracts indicators for every message that has none
+// yet (as messages are read, so spooled scrapes, resumed runs and loaded
+// exports are all covered) and aggregates them into export.Indicators.
+func summarizeIndicators(export *Export) error {
+	annotateExport(export, func(msg *Message) {
+		if msg.Indicators == nil {
+			msg.Indicators = extractIndicators(msg)
+		}
+	})
+
+	index := make(map[string]int)
+	var summaries []IndicatorSummary
+	err := forEachMessage(export, func(_ *ChannelExport, msg *Message) error {
+		for _, ind := range msg.Indicators {
+			key := ind.Type + "\x00" + ind.Value
+			i, ok := index[key]
+			if !ok {
+				index[key] = len(summaries)
+				summaries = append(summaries, IndicatorSummary{
+					Type: ind.Type, Value: ind.Value,
+					FirstSeenID: msg.ID, FirstSeenAt: msg.Timestamp,
+					LastSeenID: msg.ID, LastSeenAt: msg.Timestamp,
+				})
+				i = len(summaries) - 1
+			}
+			s := &summaries[i]
+			s.Count++
+			first := Message{ID: s.FirstSeenID, Timestamp: s.FirstSeenAt}
+			last := Message{ID: s.LastSeenID, Timestamp: s.LastSeenAt}
+			if messageBefore(msg, &first) {
+				s.FirstSeenID, s.FirstSeenAt = msg.ID, msg.Timestamp
+			}
+			if messageBefore(&last, msg) {
+				s.LastSeenID, s.LastSeenAt = msg.ID, msg.Timestamp
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	slices.SortStableFunc(summaries, func(a, b IndicatorSummary) int {
+		if c := strings.Compare(a.Type, b.Type); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Value, b.Value)
+	})
+	export.Indicators = summaries
+	if export.Indicators == nil {
+		export.Indicators = []IndicatorSummary{}
+	}
+	return nil
+}
+
+var indicatorColumns = []string{"type", "value", "count", "first_seen_message_id", "first_seen_at", "last_seen_message_id", "last_seen_at"}
+
+// writeIndicatorsFile writes export.Indicators on their own as
+// <prefix>_indicators.json or .csv for feeding other tools.
+func writeIndicatorsFile(prefix string, export *Export, format string) (string, error) {
+	base := stripExportExtension(prefix) + "_indicators"
+	switch format {
+	case "json":
+		path := base + ".json"
+		return path, writeJSON(path, export.Indicators)
+	case "csv":
+		path := base + ".csv"
+		return path, writeIndicatorsCSV(path, export.Indicators)
+	}
+	return "", errors.New("--indicators-file must be json or csv")
+}
+
+func writeIndicatorsCSV(path string, indicators []IndicatorSummary) error {
+	tables, err := createTables([]string{path}, ',')
+	if err != nil {
+		return err
+	}
+	w := tables[0]
+	writeErr := w.Write(indicatorColumns)
+	for i := 0; i < len(indicators) && writeErr == nil; i++ {
+		s := &indicators[i]
+		writeErr = w.Write([]string{
+			s.Type, s.Value, strconv.Itoa(s.Count),
+			s.FirstSeenID, s.FirstSeenAt.Format(time.RFC3339),
+			s.LastSeenID, s.LastSeenAt.Format(time.RFC3339),
+		})
+	}
+	if err := closeTables(tables); err != nil && writeErr == nil {
+		writeErr = err
+	}
+	return writeErr
+}
+
+// indicatorsEnabled reports whether the run extracts indicators, either for
+// the export itself or for a standalone file.
+func indicatorsEnabled(cfg *runConfig) bool {
+	return cfg.ExtractIndicators || cfg.IndicatorsFile != ""
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRefang(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"hxxp://evil[.]com/x", "http://evil.com/x"},
+		{"hxxps[://]evil(.)com", "https://evil.com"},
+		{"HXXPS://evil[dot]com", "https://evil.com"},
+		{"h**p://evil{.}com", "http://evil.com"},
+		{"fxp://files[.]evil[.]com", "ftp://files.evil.com"},
+		{"admin[@]evil[.]com", "admin@evil.com"},
+		{"admin (at) evil (dot) com", "admin@evil.com"},
+		{"10[.]0[.]0[.]1", "10.0.0.1"},
+		{"fe80[:]:1", "fe80::1"},
+		{"nothing to see here.", "nothing to see here."},
+	}
+	for _, tt := range tests {
+		if got := refang(tt.in); got != tt.want {
+			t.Errorf("refang(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValidBase58Check(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", true},
+		{"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", true},
+		{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb", false}, // checksum off by one
+		{"1A1zP1eP5QGefi2DMPTfTL5SLmv7Divf", false},   // truncated
+		{"1A1zP1eP5QGefi2DMPTfTL5SLmv7Divf0a", false}, // 0 is not base58
+	}
+	for _, tt := range tests {
+		if got := validBase58Check(tt.addr); got != tt.want {
+			t.Errorf("validBase58Check(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestExtractIndicators(t *testing.T) {
+	sha256 := strings.Repeat("ab", 32)
+	tests := []struct {
+		name    string
+		content string
+		want    []Indicator
+	}{
+		{"url and its host", "get it from https://evil.example/drop.bin?x=1.", []Indicator{
+			{Type: indicatorURL, Value: "https://evil.example/drop.bin?x=1"},
+			{Type: indicatorDomain, Value: "evil.example"},
+		}},
+		{"defanged url", "hxxp://evil[.]example/a", []Indicator{
+			{Type: indicatorURL, Value: "http://evil.example/a", Defanged: true},
+			{Type: indicatorDomain, Value: "evil.example", Defanged: true},
+		}},
+		{"url with ip host and port", "http://user@203.0.113.9:8080/x", []Indicator{
+			{Type: indicatorURL, Value: "http://user@203.0.113.9:8080/x"},
+			{Type: indicatorIPv4, Value: "203.0.113.9"},
+		}},
+		{"url with ipv6 host", "http://[2001:db8::1]/x", []Indicator{
+			{Type: indicatorURL, Value: "http://[2001:db8::1]/x"},
+			{Type: indicatorIPv6, Value: "2001:db8::1"},
+		}},
+		{"bare domain", "c2 is Update.Evil-Corp.example now", []Indicator{
+			{Type: indicatorDomain, Value: "update.evil-corp.example"},
+		}},
+		{"email", "mail Admin@Evil.example", []Indicator{
+			{Type: indicatorEmail, Value: "admin@evil.example"},
+			{Type: indicatorDomain, Value: "evil.example"},
+		}},
+		{"defanged email", "admin[@]evil[.]example", []Indicator{
+			{Type: indicatorEmail, Value: "admin@evil.example", Defanged: true},
+			{Type: indicatorDomain, Value: "evil.example", Defanged: true},
+		}},
+		{"ipv4", "beacon to 198.51.100.7 and 10[.]0[.]0[.]1", []Indicator{
+			{Type: indicatorIPv4, Value: "198.51.100.7"},
+			{Type: indicatorIPv4, Value: "10.0.0.1", Defanged: true},
+		}},
+		{"ipv6", "listening on 2001:db8:0:0::53 today", []Indicator{
+			{Type: indicatorIPv6, Value: "2001:db8::53"},
+		}},
+		{"hashes", "md5 d41d8cd98f00b204e9800998ecf8427e sha1 DA39A3EE5E6B4B0D3255BFEF95601890AFD80709 sha256 " + sha256, []Indicator{
+			{Type: indicatorMD5, Value: "d41d8cd98f00b204e9800998ecf8427e"},
+			{Type: indicatorSHA1, Value: "da39a3ee5e6b4b0d3255bfef95601890afd80709"},
+			{Type: indicatorSHA256, Value: sha256},
+		}},
+		{"sha512", strings.Repeat("c", 128), []Indicator{
+			{Type: indicatorSHA512, Value: strings.Repeat("c", 128)},
+		}},
+		{"cve", "patch cve-2024-3094 now", []Indicator{
+			{Type: indicatorCVE, Value: "CVE-2024-3094"},
+		}},
+		{"bitcoin", "send to 1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa or bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq", []Indicator{
+			{Type: indicatorBitcoin, Value: "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"},
+			{Type: indicatorBitcoin, Value: "bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq"},
+		}},
+		{"ether", "0xDE0B295669a9FD93d5F28D9Ec85E40f4cb697BAe", []Indicator{
+			{Type: indicatorEther, Value: "0xde0b295669a9fd93d5f28d9ec85e40f4cb697bae"},
+		}},
+		{"repeats reported once", "evil.example evil.example EVIL.example", []Indicator{
+			{Type: indicatorDomain, Value: "evil.example"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractIndicators(&Message{Content: tt.content})
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("extractIndicators(%q) =\n  %v\nwant\n  %v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractIndicatorsIgnoresLookalikes(t *testing.T) {
+	for _, content := range []string{
+		"run payload.exe then notes.txt",      // file names, not domains
+		"see https://example.com/repo/v1.tar", // path segments are not hosts
+		"version 1.2.3.4.5 shipped",           // too many octets for the pattern
+		"octets out of range: 10.0.0.300",
+		"999.1.1.1 is not an address",
+		"http://999.1.1.1/x",        // nor is the host, so it is not a domain either
+		"meeting at 10:30:45",       // clock time, not IPv6
+		"use std::vector::iterator", // C++ scope, not IPv6
+		"::",
+		"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb", // bad checksum
+		"id " + strings.Repeat("a", 50),      // hex of no hash length
+		"CVE-24-1",
+	} {
+		got := extractIndicators(&Message{Content: content})
+		// The URL itself is expected; nothing derived from its path is.
+		got = slices.DeleteFunc(got, func(ind Indicator) bool {
+			return ind.Type == indicatorURL || ind.Value == "example.com"
+		})
+		if len(got) > 0 {
+			t.Errorf("extractIndicators(%q) = %v, want nothing", content, got)
+		}
+	}
+}
+
+func TestExtractIndicatorsReadsEmbeds(t *testing.T) {
+	msg := &Message{
+		Content: "see embed",
+		Embeds: []Embed{{Title: "Alert", Fields: []EmbedField{
+			{Name: "Host", Value: "203.0.113.9"},
+		}}},
+	}
+	want := []Indicator{{Type: indicatorIPv4, Value: "203.0.113.9"}}
+	if got := extractIndicators(msg); !slices.Equal(got, want) {
+		t.Errorf("extractIndicators = %v, want %v", got, want)
+	}
+}
+
+func TestSummarizeIndicators(t *testing.T) {
+	export := &Export{Messages: []Message{
+		{ID: "2", Content: "evil.example again", Timestamp: spooledAt("2", 2).Timestamp},
+		{ID: "1", Content: "CVE-2024-3094 on evil.example", Timestamp: spooledAt("1", 1).Timestamp},
+		{ID: "3", Content: "clean", Timestamp: spooledAt("3", 3).Timestamp},
+	}}
+	if err := summarizeIndicators(export); err != nil {
+		t.Fatal(err)
+	}
+	if len(export.Indicators) != 2 {
+		t.Fatalf("summaries = %+v, want a cve and a domain", export.Indicators)
+	}
+	cve, domain := export.Indicators[0], export.Indicators[1]
+	if cve.Type != indicatorCVE || cve.Count != 1 || cve.FirstSeenID != "1" {
+		t.Errorf("cve summary = %+v", cve)
+	}
+	if domain.Value != "evil.example" || domain.Count != 2 || domain.FirstSeenID != "1" || domain.LastSeenID != "2" {
+		t.Errorf("domain summary = %+v, want seen twice, first in 1 and last in 2", domain)
+	}
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -26,6 +30,40 @@ func main() {
 		return
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "query" {
+		if err := runQuery(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "query failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "keygen" {
+		if err := runKeygen(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "keygen failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		if err := runVerify(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "verify failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	ctx := interruptContext()
+
+	if len(os.Args) > 1 && os.Args[1] == "sync" {
+		if err := runSync(ctx, os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "sync failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	cfg, err := parseConfig()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
@@ -33,46 +71,211 @@ func main() {
 	}
 
 	client := NewDiscordClient(cfg.Token)
-	messages, stats, err := client.ScrapeChannel(&cfg.Options)
+	if cfg.Options.GuildID != "" || len(cfg.ChannelIDs) > 1 {
+		runMultiChannel(ctx, client, cfg)
+		return
+	}
+
+	// The channel record supplies the guild ID, which message links need.
+	channel, metrics, err := client.fetchChannel(ctx, cfg.Options.ChannelID)
 	if err != nil {
+		fmt.Fprintln(os.Stderr, "scrape failed: fetch channel:", err)
+		os.Exit(1)
+	}
+
+	sp, stream, err := openRunSpool(&cfg.Options)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "spool failed:", err)
+		os.Exit(1)
+	}
+
+	src, stats, err := client.ScrapeChannelWithThreads(ctx, &cfg.Options, &channel, sp, stream)
+	stats.addMetrics(metrics)
+	stoppedBefore, interrupted := interruptedBefore(err)
+	if err != nil && !interrupted {
 		fmt.Fprintln(os.Stderr, "scrape failed:", err)
+		closeSpool(sp)
+		printResumeHint(cfg.Options.CheckpointPath)
 		os.Exit(1)
 	}
 
-	if len(messages) == 0 && !cfg.Quiet {
+	if interrupted && !cfg.Quiet {
+		fmt.Println("interrupted; writing partial export")
+	}
+	if src.len() == 0 && !cfg.Quiet {
 		fmt.Println("no messages matched the provided filters")
 	}
 
-	reverseMessages(messages)
+	export := Export{
+		GuildID:       channel.GuildID,
+		ChannelID:     cfg.Options.ChannelID,
+		ExportedAt:    time.Now().UTC(),
+		MessageCount:  src.len(),
+		Partial:       interrupted,
+		StoppedBefore: stoppedBefore,
+		Filters:       newFilterSummary(&cfg.Options),
+		Stats:         stats,
+		source:        src,
+	}
+
+	saveAttachments(ctx, &export, cfg)
+	outputs, err := writeOutputs(&export, cfg)
+	if err == nil {
+		outputs, err = finishOutputs(&export, cfg, outputs)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "write failed:", err)
+		closeSpool(sp)
+		os.Exit(1)
+	}
+	closeSpool(sp)
+	if path := cfg.Options.CheckpointPath; path != "" && !interrupted {
+		if err := errors.Join(removeCheckpoint(path), sp.remove()); err != nil {
+			fmt.Fprintln(os.Stderr, "warning: failed to remove checkpoint:", err)
+		}
+	}
+
+	if !cfg.Quiet {
+		fmt.Printf("wrote %d messages to %s\n", export.MessageCount, strings.Join(outputs, ", "))
+	}
+	if interrupted {
+		printResumeHint(cfg.Options.CheckpointPath)
+		os.Exit(130)
+	}
+}
+
+// openRunSpool picks where scraped pages are spooled: next to the checkpoint
+// for checkpointed scrapes, so --resume can pick them up, otherwise a temp
+// file removed when the run ends.
+func openRunSpool(opts *scrapeOptions) (*spool, *spoolStream, error) {
+	if opts.CheckpointPath != "" {
+		return openCheckpointSpool(opts.CheckpointPath, opts.Resume)
+	}
+	sp, err := newTempSpool()
+	if err != nil {
+		return nil, nil, err
+	}
+	return sp, sp.newStream(), nil
+}
+
+func closeSpool(sp *spool) {
+	if err := sp.close(); err != nil {
+		fmt.Fprintln(os.Stderr, "warning: failed to close spool:", err)
+	}
+}
+
+// printResumeHint points at the checkpoint left by a failed or interrupted
+// single-channel scrape, if one was written.
+func printResumeHint(path string) {
+	if path == "" {
+		return
+	}
+	if _, err := os.Stat(path); err == nil {
+		fmt.Fprintf(os.Stderr, "progress saved to %s; rerun with --resume %s\n", path, path)
+	}
+}
+
+// runMultiChannel handles --guild sweeps and runs with several --channel
+// values; both produce a sectioned export with per-channel stats.
+func runMultiChannel(ctx context.Context, client *DiscordClient, cfg *runConfig) {
+	sp, err := newTempSpool()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "spool failed:", err)
+		os.Exit(1)
+	}
+
+	var sections []ChannelExport
+	var skipped []SkippedChannel
+	var stats Stats
+	if cfg.Options.GuildID != "" {
+		sections, skipped, stats, err = client.ScrapeGuild(ctx, &cfg.Options, sp, cfg.Concurrency)
+	} else {
+		sections, skipped, stats, err = client.ScrapeChannels(ctx, &cfg.Options, sp, cfg.ChannelIDs, cfg.Concurrency)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "scrape failed:", err)
+		closeSpool(sp)
+		os.Exit(1)
+	}
+	interrupted := ctx.Err() != nil
+	if interrupted && !cfg.Quiet {
+		fmt.Println("interrupted; writing partial export")
+	}
+
+	total := 0
+	for i := range sections {
+		total += sections[i].MessageCount
+	}
+	if total == 0 && !cfg.Quiet {
+		fmt.Println("no messages matched the provided filters")
+	}
 
 	export := Export{
-		ChannelID:    cfg.Options.ChannelID,
+		GuildID:      cfg.Options.GuildID,
 		ExportedAt:   time.Now().UTC(),
-		MessageCount: len(messages),
-		Messages:     messages,
-		Filters: FilterSummary{
-			Since:    cfg.Options.Since,
-			Until:    cfg.Options.Until,
-			Keywords: cfg.Options.Keywords,
-			Users:    cfg.Options.Users,
-			Limit:    cfg.Options.MaxMessages,
-		},
-		Stats: stats,
+		MessageCount: total,
+		Partial:      interrupted,
+		Channels:     sections,
+		Skipped:      skipped,
+		Filters:      newFilterSummary(&cfg.Options),
+		Stats:        stats,
 	}
 
-	outputs, err := writeOutputs(&export, cfg)
+	saveAttachments(ctx, &export, cfg)
+	outputs, err := writeSectionedOutputs(&export, cfg)
+	if err == nil {
+		outputs, err = finishOutputs(&export, cfg, outputs)
+	}
+	closeSpool(sp)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "write failed:", err)
 		os.Exit(1)
 	}
 
 	if !cfg.Quiet {
-		fmt.Printf("wrote %d messages to %s\n", len(messages), strings.Join(outputs, ", "))
+		printChannelSummary(&export)
+		fmt.Printf("wrote %d messages from %d channels (%d skipped) to %s\n",
+			total, len(sections), len(skipped), strings.Join(outputs, ", "))
+	}
+	if interrupted {
+		os.Exit(130)
+	}
+}
+
+// interruptContext returns a context canceled by the first SIGINT/SIGTERM so
+// scrapes can stop and write what they have. Default signal handling is then
+// restored, so a second Ctrl-C kills the process outright.
+func interruptContext() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx
+}
+
+func printChannelSummary(export *Export) {
+	for i := range export.Channels {
+		section := &export.Channels[i]
+		fmt.Printf("  #%s (%s): %d messages, %d requests, %d rate limit hits\n",
+			section.Name, section.ChannelID, section.MessageCount, section.Stats.Requests, section.Stats.RateLimitHits)
 	}
+	fmt.Printf("  total: %d messages, %d requests, %d rate limit hits, %d proactive waits\n",
+		export.MessageCount, export.Stats.Requests, export.Stats.RateLimitHits, export.Stats.ProactiveWaits)
 }
 
-func reverseMessages(messages []Message) {
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+func newFilterSummary(opts *scrapeOptions) FilterSummary {
+	return FilterSummary{
+		Since:           opts.Since,
+		Until:           opts.Until,
+		Keywords:        opts.Keywords,
+		Users:           opts.Users,
+		Query:           opts.Query,
+		Regexes:         opts.Regexes,
+		ExcludeKeywords: opts.ExcludeKeywords,
+		ExcludeUsers:    opts.ExcludeUsers,
+		Bots:            opts.Bots,
+		Types:           opts.Types,
+		Limit:           opts.MaxMessages,
 	}
 }
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Manifest is the chain-of-custody record written next to a run's output as
+// <prefix>_manifest.json: who produced which files, with what build and
+// filters, and the SHA-256 of each file as written. SigningKey is the
+// fingerprint of the --sign key, if the run signed its files. `ripcord
+// verify` re-hashes the files against it.
+type Manifest struct {
+	Tool        string         `json:"tool"`
+	Version     string         `json:"version"`
+	Commit      string         `json:"commit,omitempty"`
+	BuildDate   string         `json:"build_date,omitempty"`
+	Operator    string         `json:"operator"`
+	Host        string         `json:"host"`
+	Command     []string       `json:"command"`
+	SigningKey  string         `json:"signing_key,omitempty"`
+	GuildID     string         `json:"guild_id,omitempty"`
+	ChannelID   string         `json:"channel_id,omitempty"`
+	Filters     FilterSummary  `json:"filters"`
+	StartedAt   time.Time      `json:"started_at"`
+	ExportedAt  time.Time      `json:"exported_at"`
+	CompletedAt time.Time      `json:"completed_at"`
+	Files       []ManifestFile `json:"files"`
+}
+
+// ManifestFile is one written file. Path is relative to the manifest so the
+// manifest and its files can be moved together.
+type ManifestFile struct {
+	Path       string    `json:"path"`
+	Size       int64     `json:"size_bytes"`
+	SHA256     string    `json:"sha256"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+const manifestSuffix = "_manifest.json"
+
+// runStarted is when this process began, recorded as the manifest's
+// started_at.
+var runStarted = time.Now().UTC()
+
+// writeManifest hashes files (plus everything under dirs) and writes the
+// manifest for them next to prefix, returning its path. key, if set, is the
+// key the files were signed with. Runs that wrote nothing to disk, such as
+// --output - streams, get no manifest and return "".
+func writeManifest(prefix string, export *Export, files, dirs []string, key ed25519.PrivateKey) (string, error) {
+	path := stripExportExtension(prefix) + manifestSuffix
+	base := filepath.Dir(path)
+
+	manifest := Manifest{
+		Tool:       "ripcord",
+		Version:    version,
+		Commit:     commit,
+		BuildDate:  date,
+		Operator:   currentOperator(),
+		Host:       currentHost(),
+		Command:    redactArgs(os.Args[1:]),
+		GuildID:    export.GuildID,
+		ChannelID:  export.ChannelID,
+		Filters:    export.Filters,
+		StartedAt:  runStarted,
+		ExportedAt: export.ExportedAt,
+	}
+	if key != nil {
+		manifest.SigningKey = keyFingerprint(key.Public().(ed25519.PublicKey))
+	}
+	for _, file := range files {
+		if file == stdoutOutput {
+			continue
+		}
+		entry, err := manifestEntry(base, file)
+		if err != nil {
+			return "", err
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			entry, err := manifestEntry(base, file)
+			if err == nil {
+				manifest.Files = append(manifest.Files, entry)
+			}
+			return err
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+	if len(manifest.Files) == 0 {
+		return "", nil
+	}
+
+	manifest.CompletedAt = time.Now().UTC()
+	if err := writeJSON(path, &manifest); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// finishOutputs runs once a run's outputs are written: with --sign it signs
+// each of them, then it writes the manifest covering the outputs, their
+// signatures and any attachments downloaded, and signs the manifest too. It
+// returns the outputs with everything it added.
+func finishOutputs(export *Export, cfg *runConfig, outputs []string) ([]string, error) {
+	if cfg.SigningKey != nil {
+		sigs, err := signFiles(cfg.SigningKey, outputs)
+		if err != nil {
+			return outputs, err
+		}
+		outputs = append(outputs, sigs...)
+	}
+	var dirs []string
+	if cfg.DownloadAttachments {
+		dirs = append(dirs, stripExportExtension(cfg.OutputPrefix)+attachmentDirSuffix)
+	}
+	path, err := writeManifest(cfg.OutputPrefix, export, outputs, dirs, cfg.SigningKey)
+	if err != nil || path == "" {
+		return outputs, err
+	}
+	outputs = append(outputs, path)
+	if cfg.SigningKey != nil {
+		sig, err := signFile(cfg.SigningKey, path)
+		if err != nil {
+			return outputs, fmt.Errorf("sign %s: %w", path, err)
+		}
+		outputs = append(outputs, sig)
+	}
+	return outputs, nil
+}
+
+func manifestEntry(base, file string) (ManifestFile, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	sum, size, err := hashFile(file)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	rel, err := filepath.Rel(base, file)
+	if err != nil {
+		rel = file
+	}
+	return ManifestFile{
+		Path:       filepath.ToSlash(rel),
+		Size:       size,
+		SHA256:     sum,
+		ModifiedAt: info.ModTime().UTC(),
+	}, nil
+}
+
+func hashFile(path string) (sum string, size int64, err error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		if cerr := file.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	h := sha256.New()
+	n, err := io.Copy(h, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+func currentOperator() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	for _, key := range []string{"USER", "USERNAME"} {
+		if name := os.Getenv(key); name != "" {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+func currentHost() string {
+	if host, err := os.Hostname(); err == nil {
+		return host
+	}
+	return "unknown"
+}
+
+// redactArgs copies the command line with --token values blanked out, so
+// the manifest records the filters without leaking credentials.
+func redactArgs(args []string) []string {
+	out := slices.Clone(args)
+	for i, arg := range out {
+		if !isTokenFlag(arg) {
+			continue
+		}
+		if eq := strings.Index(arg, "="); eq >= 0 {
+			out[i] = arg[:eq+1] + "REDACTED"
+		} else if i+1 < len(out) {
+			out[i+1] = "REDACTED"
+		}
+	}
+	return out
+}
+
+func isTokenFlag(arg string) bool {
+	if !strings.HasPrefix(arg, "-") {
+		return false
+	}
+	name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+	return name == "token"
+}
+
+// runVerify implements `ripcord verify <manifest.json>`: it re-hashes every
+// file the manifest lists and reports any that are missing or no longer
+// match, failing if one does. With --pubkey it also checks the manifest's
+// and each file's detached signature against that key.
+func runVerify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	pubkeyPath := flags.String("pubkey", "", "Public key (from keygen) the manifest and files must be signed with")
+	quiet := flags.Bool("quiet", false, "Only print files that fail verification")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: ripcord verify [--pubkey <key.pub>] [--quiet] <manifest.json>")
+	}
+	var pub ed25519.PublicKey
+	if *pubkeyPath != "" {
+		var err error
+		if pub, err = loadPublicKey(*pubkeyPath); err != nil {
+			return fmt.Errorf("load public key: %w", err)
+		}
+	}
+
+	path := flags.Arg(0)
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(manifest.Files) == 0 {
+		return fmt.Errorf("%s lists no files", path)
+	}
+
+	if pub != nil {
+		// The manifest's own signature comes first: without it, a forged
+		// manifest could vouch for altered files.
+		if problem := checkSignature(pub, path); problem != "" {
+			return fmt.Errorf("%s: %s", path, problem)
+		}
+	}
+
+	// Only files signed alongside the manifest have a .sig to check.
+	// Downloaded attachments and the signatures themselves are covered by
+	// their hashes in the manifest, whose own signature has just verified.
+	listed := make(map[string]bool, len(manifest.Files))
+	for _, entry := range manifest.Files {
+		listed[entry.Path] = true
+	}
+
+	base := filepath.Dir(path)
+	failed := 0
+	for _, entry := range manifest.Files {
+		signer := pub
+		if !listed[entry.Path+signatureSuffix] {
+			signer = nil
+		}
+		if problem := verifyManifestFile(base, entry, signer); problem != "" {
+			failed++
+			fmt.Printf("FAIL %s: %s\n", entry.Path, problem)
+		} else if !*quiet {
+			fmt.Printf("ok   %s\n", entry.Path)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed verification", failed, len(manifest.Files))
+	}
+	if !*quiet {
+		fmt.Printf("all %d files match the manifest (written by %s on %s at %s)\n",
+			len(manifest.Files), manifest.Operator, manifest.Host, manifest.CompletedAt.Format(time.RFC3339))
+		switch {
+		case pub != nil:
+			fmt.Printf("signatures verified against %s\n", keyFingerprint(pub))
+		case manifest.SigningKey != "":
+			fmt.Printf("signed by %s; pass --pubkey to check the signatures\n", manifest.SigningKey)
+		}
+	}
+	return nil
+}
+
+// verifyManifestFile describes what is wrong with one file, or returns ""
+// when it matches its entry and, given pub, carries a valid signature.
+func verifyManifestFile(base string, entry ManifestFile, pub ed25519.PublicKey) string {
+	file := filepath.FromSlash(entry.Path)
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(base, file)
+	}
+	sum, size, err := hashFile(file)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return "missing"
+	case err != nil:
+		return err.Error()
+	case sum != entry.SHA256:
+		return fmt.Sprintf("modified (sha256 %s, expected %s; %d bytes, expected %d)", sum, entry.SHA256, size, entry.Size)
+	case pub != nil:
+		return checkSignature(pub, file)
+	}
+	return ""
+}
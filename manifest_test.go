@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestRun lays out a run's outputs under dir: an export, a Markdown
+// transcript and one downloaded attachment, then writes their manifest.
+func writeTestRun(t *testing.T, dir string) (manifest string, files []string) {
+	t.Helper()
+	prefix := filepath.Join(dir, "run")
+	attachments := prefix + attachmentDirSuffix
+	if err := os.Mkdir(attachments, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	contents := map[string]string{
+		prefix + ".json": `{"messages": []}`,
+		prefix + ".md":   "# run\n",
+		filepath.Join(attachments, "a1_drop.bin"): "abcd",
+	}
+	for path, data := range contents {
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	export := &Export{ChannelID: "100", ExportedAt: time.Now().UTC()}
+	manifest, err := writeManifest(prefix+".json", export, []string{prefix + ".json", prefix + ".md"}, []string{attachments}, nil)
+	if err != nil {
+		t.Fatalf("writeManifest: %v", err)
+	}
+	return manifest, []string{prefix + ".json", prefix + ".md", filepath.Join(attachments, "a1_drop.bin")}
+}
+
+func TestWriteManifestListsFilesRelative(t *testing.T) {
+	dir := t.TempDir()
+	path, _ := writeTestRun(t, dir)
+	if path != filepath.Join(dir, "run"+manifestSuffix) {
+		t.Errorf("manifest written to %s", path)
+	}
+
+	var manifest Manifest
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range manifest.Files {
+		paths = append(paths, f.Path)
+	}
+	want := []string{"run.json", "run.md", "run_files/a1_drop.bin"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("manifest paths = %v, want %v", paths, want)
+	}
+	// sha256("abcd")
+	if got := manifest.Files[2]; got.Size != 4 || got.SHA256 != "88d4266fd4e6338d13b845fcf289579d209c897823b9217da3e161936f031589" {
+		t.Errorf("attachment entry = %+v", got)
+	}
+	if manifest.Tool != "ripcord" || manifest.ChannelID != "100" || manifest.CompletedAt.IsZero() {
+		t.Errorf("manifest header = %+v", manifest)
+	}
+}
+
+func TestWriteManifestSkipsStdout(t *testing.T) {
+	path, err := writeManifest(stdoutOutput, &Export{}, []string{stdoutOutput}, nil, nil)
+	if err != nil || path != "" {
+		t.Errorf("writeManifest for a stdout stream = %q, %v; want no manifest", path, err)
+	}
+}
+
+func TestRunVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(t *testing.T, files []string)
+		wantErr string
+	}{
+		{"untouched", func(*testing.T, []string) {}, ""},
+		{"modified", func(t *testing.T, files []string) {
+			if err := os.WriteFile(files[0], []byte(`{"messages": [1]}`), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}, "1 of 3 files failed verification"},
+		{"missing attachment", func(t *testing.T, files []string) {
+			if err := os.Remove(files[2]); err != nil {
+				t.Fatal(err)
+			}
+		}, "1 of 3 files failed verification"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			manifest, files := writeTestRun(t, dir)
+			tt.tamper(t, files)
+
+			// Verify from elsewhere: paths resolve against the manifest.
+			moved := filepath.Join(t.TempDir(), "evidence")
+			if err := os.Rename(dir, moved); err != nil {
+				t.Fatal(err)
+			}
+			err := runVerify([]string{"--quiet", filepath.Join(moved, filepath.Base(manifest))})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("runVerify: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("runVerify = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyManifestFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("abcd"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	good := ManifestFile{Path: "a.txt", Size: 4, SHA256: "88d4266fd4e6338d13b845fcf289579d209c897823b9217da3e161936f031589"}
+	if problem := verifyManifestFile(dir, good, nil); problem != "" {
+		t.Errorf("matching file reported %q", problem)
+	}
+	bad := good
+	bad.SHA256 = strings.Repeat("0", 64)
+	if problem := verifyManifestFile(dir, bad, nil); !strings.HasPrefix(problem, "modified") {
+		t.Errorf("changed file reported %q, want modified", problem)
+	}
+	gone := good
+	gone.Path = "b.txt"
+	if problem := verifyManifestFile(dir, gone, nil); problem != "missing" {
+		t.Errorf("absent file reported %q, want missing", problem)
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	tests := []struct {
+		args, want []string
+	}{
+		{[]string{"--token", "secret", "--channel", "1"}, []string{"--token", "REDACTED", "--channel", "1"}},
+		{[]string{"-token=secret"}, []string{"-token=REDACTED"}},
+		{[]string{"--channel", "1", "--token"}, []string{"--channel", "1", "--token"}},
+		{[]string{"--token-file", "x", "token"}, []string{"--token-file", "x", "token"}},
+	}
+	for _, tt := range tests {
+		args := slices.Clone(tt.args)
+		if got := redactArgs(args); !slices.Equal(got, tt.want) {
+			t.Errorf("redactArgs(%v) = %v, want %v", tt.args, got, tt.want)
+		}
+		if !slices.Equal(args, tt.args) {
+			t.Errorf("redactArgs modified its input to %v", args)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// messageType names one of Discord's message types for --type. event is how
+// Markdown describes a system message of that type after the author's name;
+// conversational types leave it empty.
+type messageType struct {
+	id    int
+	name  string
+	event string
+}
+
+var messageTypes = []messageType{
+	{0, "default", ""},
+	{1, "recipient-add", "added someone to the group"},
+	{2, "recipient-remove", "removed someone from the group"},
+	{3, "call", "started a call"},
+	{4, "channel-name-change", "changed the channel name"},
+	{5, "channel-icon-change", "changed the channel icon"},
+	{6, "pin", "pinned a message"},
+	{7, "join", "joined the server"},
+	{8, "boost", "boosted the server"},
+	{9, "boost-tier-1", "boosted the server to level 1"},
+	{10, "boost-tier-2", "boosted the server to level 2"},
+	{11, "boost-tier-3", "boosted the server to level 3"},
+	{12, "channel-follow", "followed a channel into this one"},
+	{14, "discovery-disqualified", "got the server disqualified from Discovery"},
+	{15, "discovery-requalified", "got the server requalified for Discovery"},
+	{16, "discovery-grace-warning", "triggered a Discovery grace period warning"},
+	{17, "discovery-final-warning", "triggered a final Discovery warning"},
+	{18, "thread-created", "started a thread"},
+	{19, "reply", ""},
+	{20, "slash-command", ""},
+	{21, "thread-starter", "opened the thread from a message"},
+	{22, "invite-reminder", "posted an invite reminder"},
+	{23, "context-menu-command", ""},
+	{24, "automod", "had a message flagged by AutoMod"},
+	{25, "role-subscription", "purchased a role subscription"},
+	{26, "premium-upsell", "triggered a premium upsell"},
+	{27, "stage-start", "started a stage"},
+	{28, "stage-end", "ended a stage"},
+	{29, "stage-speaker", "became a stage speaker"},
+	{31, "stage-topic", "changed the stage topic"},
+	{32, "app-subscription", "subscribed to an app"},
+	{36, "raid-alerts-enabled", "enabled raid alert mode"},
+	{37, "raid-alerts-disabled", "disabled raid alert mode"},
+	{38, "raid-report", "reported a raid"},
+	{39, "raid-false-alarm", "reported a raid false alarm"},
+	{44, "purchase", "made a purchase"},
+	{46, "poll-result", "closed a poll"},
+}
+
+// systemTypeAlias selects every non-conversational type at once.
+const systemTypeAlias = "system"
+
+func lookupMessageType(id int) (messageType, bool) {
+	for _, mt := range messageTypes {
+		if mt.id == id {
+			return mt, true
+		}
+	}
+	return messageType{}, false
+}
+
+// messageTypeName returns the --type name for id, or the number itself for
+// types this release does not know.
+func messageTypeName(id int) string {
+	if mt, ok := lookupMessageType(id); ok {
+		return mt.name
+	}
+	return strconv.Itoa(id)
+}
+
+// isSystemMessage reports whether a type is a Discord-generated event
+// (joins, pins, boosts, ...) rather than something a user wrote. Unknown
+// types count as system events since every conversational type is listed.
+func isSystemMessage(id int) bool {
+	mt, ok := lookupMessageType(id)
+	return !ok || mt.event != ""
+}
+
+// normalizeMessageTypes validates --type values (names, numbers or
+// "system"), returning them as canonical names with duplicates dropped.
+func normalizeMessageTypes(values []string) ([]string, error) {
+	var names []string
+	seen := make(map[string]struct{})
+	for _, value := range splitValues(values) {
+		name, err := canonicalTypeName(strings.ToLower(value))
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func canonicalTypeName(value string) (string, error) {
+	if value == systemTypeAlias {
+		return value, nil
+	}
+	if id, err := strconv.Atoi(value); err == nil && id >= 0 {
+		return messageTypeName(id), nil
+	}
+	for _, mt := range messageTypes {
+		if mt.name == value {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("unknown message type %q (use a number, %q, or one of: %s)", value, systemTypeAlias, strings.Join(messageTypeNames(), ", "))
+}
+
+func messageTypeNames() []string {
+	names := make([]string, 0, len(messageTypes))
+	for _, mt := range messageTypes {
+		names = append(names, mt.name)
+	}
+	return names
+}
+
+// typeFilter matches messages whose type is in the set; system matches every
+// system event.
+type typeFilter struct {
+	ids    map[int]struct{}
+	system bool
+}
+
+func newTypeFilter(names []string) (typeFilter, error) {
+	f := typeFilter{ids: make(map[int]struct{})}
+	for _, name := range names {
+		if name == systemTypeAlias {
+			f.system = true
+			continue
+		}
+		if id, err := strconv.Atoi(name); err == nil {
+			f.ids[id] = struct{}{}
+			continue
+		}
+		found := false
+		for _, mt := range messageTypes {
+			if mt.name == name {
+				f.ids[mt.id], found = struct{}{}, true
+			}
+		}
+		if !found {
+			return typeFilter{}, fmt.Errorf("unknown message type %q", name)
+		}
+	}
+	return f, nil
+}
+
+func (f typeFilter) match(m *filterMessage) bool {
+	if _, ok := f.ids[m.Type]; ok {
+		return true
+	}
+	return f.system && isSystemMessage(m.Type)
+}
+
+// systemEventText describes a system message for Markdown, e.g. "alice
+// pinned a message".
+func systemEventText(msg *Message) string {
+	event := "triggered a " + messageTypeName(msg.Type) + " event"
+	if mt, ok := lookupMessageType(msg.Type); ok {
+		event = mt.event
+	}
+	return describeAuthor(&msg.Author) + " " + event
+}
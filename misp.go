@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mispEvent is the MISP event written by --format misp, in the JSON layout
+// MISP's "Import from... MISP JSON" accepts. Attributes are streamed
+// separately so the event never holds every message link in memory.
+type mispEvent struct {
+	UUID          string    `json:"uuid"`
+	Info          string    `json:"info"`
+	Date          string    `json:"date"`
+	Timestamp     string    `json:"timestamp"`
+	ThreatLevelID string    `json:"threat_level_id"`
+	Analysis      string    `json:"analysis"`
+	Distribution  string    `json:"distribution"`
+	Published     bool      `json:"published"`
+	Tag           []mispTag `json:"Tag,omitempty"`
+}
+
+type mispTag struct {
+	Name string `json:"name"`
+}
+
+type mispAttribute struct {
+	UUID         string `json:"uuid"`
+	Type         string `json:"type"`
+	Category     string `json:"category"`
+	Value        string `json:"value"`
+	ToIDs        bool   `json:"to_ids"`
+	Comment      string `json:"comment,omitempty"`
+	Timestamp    string `json:"timestamp"`
+	Distribution string `json:"distribution"`
+	FirstSeen    string `json:"first_seen,omitempty"`
+	LastSeen     string `json:"last_seen,omitempty"`
+}
+
+// mispMapping is how an extracted indicator type is filed in MISP.
+type mispMapping struct {
+	kind     string
+	category string
+	toIDs    bool
+	comment  string
+}
+
+const mispExtension = ".misp.json"
+
+// MISP enumerations used for every event: threat level "undefined", analysis
+// "initial", distribution "your organisation only" for the event and
+// "inherit event" for its attributes. Analysts widen them after review.
+const (
+	mispThreatUndefined     = "4"
+	mispAnalysisInitial     = "0"
+	mispDistributionOrg     = "0"
+	mispDistributionInherit = "5"
+)
+
+var mispMappings = map[string]mispMapping{
+	indicatorURL:     {"url", "Network activity", true, ""},
+	indicatorDomain:  {"domain", "Network activity", true, ""},
+	indicatorIPv4:    {"ip-dst", "Network activity", true, ""},
+	indicatorIPv6:    {"ip-dst", "Network activity", true, ""},
+	indicatorEmail:   {"email", "Network activity", true, ""},
+	indicatorMD5:     {"md5", "Payload delivery", true, ""},
+	indicatorSHA1:    {"sha1", "Payload delivery", true, ""},
+	indicatorSHA256:  {"sha256", "Payload delivery", true, ""},
+	indicatorSHA512:  {"sha512", "Payload delivery", true, ""},
+	indicatorCVE:     {"vulnerability", "External analysis", false, ""},
+	indicatorBitcoin: {"btc", "Financial fraud", false, ""},
+	// MISP has no Ethereum attribute type; a text attribute in the same
+	// category keeps the address importable.
+	indicatorEther: {"text", "Financial fraud", false, "Ethereum address. "},
+}
+
+// writeMISP writes the export as a single MISP event: a link attribute per
+// message, a filename|sha256 attribute per downloaded attachment, and an
+// attribute per extracted indicator. Keywords from the filters that occur
+// in at least one message become ripcord:keyword tags, and the event info
+// names the channel and time window.
+func writeMISP(path string, export *Export) (err error) {
+	if export.Indicators == nil {
+		if err := summarizeIndicators(export); err != nil {
+			return err
+		}
+	}
+	event, err := newMISPEvent(export)
+	if err != nil {
+		return err
+	}
+	header, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := file.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	w := bufio.NewWriter(file)
+	mw := &mispWriter{w: w, event: event.UUID, timestamp: event.Timestamp, hashes: make(map[string]struct{})}
+	// Reopen the marshaled event to stream its Attribute list.
+	fmt.Fprintf(w, "{\"Event\": %s,\n  \"Attribute\": [", header[:len(header)-1])
+	err = forEachMessage(export, func(section *ChannelExport, msg *Message) error {
+		if section != nil && section.GuildID != "" {
+			return mw.message(section.GuildID, msg)
+		}
+		return mw.message(export.GuildID, msg)
+	})
+	if err != nil {
+		return err
+	}
+	if err := mw.indicators(export.Indicators); err != nil {
+		return err
+	}
+	if _, err := w.WriteString("\n  ]\n}}\n"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// newMISPEvent builds the event header. It reads the messages once up front
+// to find the time window they cover and which keywords they matched.
+func newMISPEvent(export *Export) (mispEvent, error) {
+	// Keywords are matched the way --keyword filters: case-insensitively,
+	// with runs of whitespace collapsed in both the keyword and the text.
+	keywords := export.Filters.Keywords
+	needles := make([]string, len(keywords))
+	for i, keyword := range keywords {
+		needles[i] = strings.Join(strings.Fields(strings.ToLower(keyword)), " ")
+	}
+	var first, last time.Time
+	matched := make(map[string]struct{})
+	err := forEachMessage(export, func(_ *ChannelExport, msg *Message) error {
+		if first.IsZero() || msg.Timestamp.Before(first) {
+			first = msg.Timestamp
+		}
+		if msg.Timestamp.After(last) {
+			last = msg.Timestamp
+		}
+		if len(matched) < len(keywords) {
+			text := newFilterMessage(msg).lower
+			for i, needle := range needles {
+				if needle != "" && strings.Contains(text, needle) {
+					matched[keywords[i]] = struct{}{}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return mispEvent{}, err
+	}
+
+	if f := export.Filters; f.Since != nil || f.Until != nil {
+		first, last = time.Time{}, time.Time{}
+		if f.Since != nil {
+			first = *f.Since
+		}
+		if f.Until != nil {
+			last = *f.Until
+		}
+	}
+	event := mispEvent{
+		UUID:          uuid5("misp-event:" + export.GuildID + "/" + export.ChannelID + "/" + export.ExportedAt.UTC().Format(time.RFC3339Nano)),
+		Info:          mispEventInfo(export, first, last),
+		Date:          export.ExportedAt.UTC().Format(time.DateOnly),
+		Timestamp:     strconv.FormatInt(export.ExportedAt.Unix(), 10),
+		ThreatLevelID: mispThreatUndefined,
+		Analysis:      mispAnalysisInitial,
+		Distribution:  mispDistributionOrg,
+	}
+	for _, keyword := range keywords {
+		if _, ok := matched[keyword]; ok {
+			event.Tag = append(event.Tag, mispTag{Name: fmt.Sprintf("ripcord:keyword=%q", keyword)})
+		}
+	}
+	return event, nil
+}
+
+// mispEventInfo describes the export, e.g. "Discord channel 123: 42 messages
+// from 2026-01-01T00:00:00Z to 2026-01-07T00:00:00Z".
+func mispEventInfo(export *Export, first, last time.Time) string {
+	scope := "Discord export"
+	switch {
+	case export.ChannelID != "":
+		scope = "Discord channel " + export.ChannelID
+	case export.GuildID != "":
+		scope = "Discord guild " + export.GuildID
+	}
+	info := fmt.Sprintf("%s: %d messages", scope, export.MessageCount)
+	switch {
+	case !first.IsZero() && !last.IsZero():
+		info += " from " + first.UTC().Format(time.RFC3339) + " to " + last.UTC().Format(time.RFC3339)
+	case !first.IsZero():
+		info += " since " + first.UTC().Format(time.RFC3339)
+	case !last.IsZero():
+		info += " until " + last.UTC().Format(time.RFC3339)
+	}
+	if export.Partial {
+		info += " (partial export" + stoppedSuffix(export.StoppedBefore) + ")"
+	}
+	return info
+}
+
+type mispWriter struct {
+	w         *bufio.Writer
+	event     string
+	timestamp string
+	count     int
+	// hashes keeps an attachment posted more than once from being listed
+	// twice; MISP rejects duplicate values within an event.
+	hashes map[string]struct{}
+}
+
+// uuid derives an attribute UUID from the event's and the attribute's own
+// identity. MISP requires attribute UUIDs to be unique across events, so the
+// same indicator in two events must not share one.
+func (mw *mispWriter) uuid(kind, value string) string {
+	return uuid5("misp-attribute:" + mw.event + "/" + kind + ":" + value)
+}
+
+// attribute appends one attribute to the event's Attribute array.
+func (mw *mispWriter) attribute(attr mispAttribute) error {
+	attr.Timestamp = mw.timestamp
+	attr.Distribution = mispDistributionInherit
+	data, err := json.Marshal(attr)
+	if err != nil {
+		return err
+	}
+	sep := ",\n    "
+	if mw.count == 0 {
+		sep = "\n    "
+	}
+	mw.count++
+	if _, err := mw.w.WriteString(sep); err != nil {
+		return err
+	}
+	_, err = mw.w.Write(data)
+	return err
+}
+
+func (mw *mispWriter) message(guildID string, msg *Message) error {
+	seen := msg.Timestamp.UTC().Format(time.RFC3339)
+	if link := messageURL(guildID, msg); link != "" {
+		err := mw.attribute(mispAttribute{
+			UUID:      mw.uuid("link", msg.ID),
+			Type:      "link",
+			Category:  "External analysis",
+			Value:     link,
+			Comment:   fmt.Sprintf("Discord message by %s at %s", describeAuthor(&msg.Author), seen),
+			FirstSeen: seen,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, att := range msg.Attachments {
+		if att.SHA256 == "" {
+			continue
+		}
+		value := att.Filename + "|" + att.SHA256
+		if _, dup := mw.hashes[value]; dup {
+			continue
+		}
+		mw.hashes[value] = struct{}{}
+		err := mw.attribute(mispAttribute{
+			UUID:      mw.uuid("attachment", value),
+			Type:      "filename|sha256",
+			Category:  "Payload delivery",
+			Value:     value,
+			Comment:   "Attachment on Discord message " + msg.ID,
+			FirstSeen: seen,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mw *mispWriter) indicators(summaries []IndicatorSummary) error {
+	for i := range summaries {
+		s := &summaries[i]
+		m, ok := mispMappings[s.Type]
+		if !ok {
+			continue
+		}
+		err := mw.attribute(mispAttribute{
+			UUID:      mw.uuid(s.Type, s.Value),
+			Type:      m.kind,
+			Category:  m.category,
+			Value:     s.Value,
+			ToIDs:     m.toIDs,
+			Comment:   fmt.Sprintf("%sSeen %s in Discord, first in message %s.", m.comment, seenTimes(s.Count), s.FirstSeenID),
+			FirstSeen: s.FirstSeenAt.UTC().Format(time.RFC3339),
+			LastSeen:  s.LastSeenAt.UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// messageURL is the discord.com link that opens a message, or "" when the
+// guild is unknown (direct messages, and exports written before guild IDs
+// were recorded): a link without the right guild does not open the message.
+func messageURL(guildID string, msg *Message) string {
+	if guildID == "" {
+		return ""
+	}
+	return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", guildID, msg.ChannelID, msg.ID)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mispFile struct {
+	Event struct {
+		mispEvent
+		Attribute []mispAttribute `json:"Attribute"`
+	} `json:"Event"`
+}
+
+// readMISP writes export as a MISP event and decodes it back.
+func readMISP(t *testing.T, export *Export) mispFile {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "out"+mispExtension)
+	if err := writeMISP(path, export); err != nil {
+		t.Fatalf("writeMISP: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file mispFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("event is not valid JSON: %v\n%s", err, data)
+	}
+	return file
+}
+
+// mispTestExport is a guild channel export filtered on two keywords, one
+// of which only matches across a line break, with a downloaded attachment
+// posted twice and a domain mentioned once.
+func mispTestExport(exportedAt time.Time) *Export {
+	first := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	attachment := Attachment{ID: "a1", Filename: "drop.bin", SHA256: strings.Repeat("ab", 32)}
+	return &Export{
+		GuildID:      "9",
+		ChannelID:    "100",
+		ExportedAt:   exportedAt,
+		MessageCount: 2,
+		Filters:      FilterSummary{Keywords: []string{"Exploit  Chain", "ransomware"}},
+		Messages: []Message{
+			{
+				ID:          "1",
+				ChannelID:   "100",
+				Content:     "new exploit\nchain, stage two on evil.example",
+				Author:      Author{ID: "42", Username: "alice"},
+				Timestamp:   first,
+				Attachments: []Attachment{attachment},
+			},
+			{
+				ID:          "2",
+				ChannelID:   "100",
+				Content:     "reposting",
+				Author:      Author{ID: "43", Username: "bob"},
+				Timestamp:   first.Add(time.Minute),
+				Attachments: []Attachment{attachment},
+			},
+		},
+	}
+}
+
+func TestWriteMISPEvent(t *testing.T) {
+	exportedAt := time.Date(2025, 3, 12, 8, 30, 0, 0, time.UTC)
+	file := readMISP(t, mispTestExport(exportedAt))
+
+	event := file.Event
+	if event.Info != "Discord channel 100: 2 messages from 2025-03-10T12:00:00Z to 2025-03-10T12:01:00Z" {
+		t.Errorf("info = %q", event.Info)
+	}
+	if event.Date != "2025-03-12" || event.Published || event.Distribution != mispDistributionOrg {
+		t.Errorf("event date %q published %v distribution %q", event.Date, event.Published, event.Distribution)
+	}
+	if len(event.Tag) != 1 || event.Tag[0].Name != `ripcord:keyword="Exploit  Chain"` {
+		t.Errorf("tags = %v, want only the keyword that matched", event.Tag)
+	}
+
+	byType := make(map[string][]mispAttribute)
+	for _, attr := range file.Event.Attribute {
+		byType[attr.Type] = append(byType[attr.Type], attr)
+		if attr.Distribution != mispDistributionInherit || attr.Timestamp != event.Timestamp {
+			t.Errorf("%s %s: distribution %q timestamp %q", attr.Type, attr.Value, attr.Distribution, attr.Timestamp)
+		}
+	}
+	if links := byType["link"]; len(links) != 2 || links[0].Value != "https://discord.com/channels/9/100/1" {
+		t.Errorf("link attributes = %+v", links)
+	}
+	if hashes := byType["filename|sha256"]; len(hashes) != 1 {
+		t.Errorf("%d attachment attributes, want the repost folded into 1", len(hashes))
+	}
+	domains := byType["domain"]
+	if len(domains) != 1 || domains[0].Value != "evil.example" || !domains[0].ToIDs {
+		t.Fatalf("domain attributes = %+v", domains)
+	}
+	if domains[0].Comment != "Seen once in Discord, first in message 1." {
+		t.Errorf("domain comment = %q", domains[0].Comment)
+	}
+}
+
+func TestWriteMISPAttributeUUIDsPerEvent(t *testing.T) {
+	exportedAt := time.Date(2025, 3, 12, 8, 30, 0, 0, time.UTC)
+	first := readMISP(t, mispTestExport(exportedAt))
+	again := readMISP(t, mispTestExport(exportedAt))
+	later := readMISP(t, mispTestExport(exportedAt.Add(24*time.Hour)))
+
+	if first.Event.UUID != again.Event.UUID {
+		t.Error("rewriting the same export changed the event UUID")
+	}
+	if first.Event.UUID == later.Event.UUID {
+		t.Error("a later export reused the event UUID")
+	}
+
+	uuids := make(map[string]string)
+	for i, attr := range first.Event.Attribute {
+		if again.Event.Attribute[i].UUID != attr.UUID {
+			t.Errorf("%s %s: UUID changed when the same export was rewritten", attr.Type, attr.Value)
+		}
+		if prev, dup := uuids[attr.UUID]; dup {
+			t.Errorf("%s %s shares a UUID with %s", attr.Type, attr.Value, prev)
+		}
+		uuids[attr.UUID] = attr.Type + " " + attr.Value
+	}
+	// MISP rejects an attribute UUID already used by another event.
+	for _, attr := range later.Event.Attribute {
+		if prev, dup := uuids[attr.UUID]; dup {
+			t.Errorf("%s %s in the later event reuses the UUID of %s", attr.Type, attr.Value, prev)
+		}
+	}
+}
+
+func TestWriteMISPWithoutGuild(t *testing.T) {
+	export := mispTestExport(time.Date(2025, 3, 12, 8, 30, 0, 0, time.UTC))
+	export.GuildID = ""
+	for _, attr := range readMISP(t, export).Event.Attribute {
+		if attr.Type == "link" {
+			t.Errorf("link %s written without a guild to open it in", attr.Value)
+		}
+	}
+}
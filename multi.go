@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// channelResult is one worker's outcome for a single channel.
+type channelResult struct {
+	section ChannelExport
+	skipped *SkippedChannel
+	err     error
+}
+
+// ScrapeChannels scrapes several explicitly listed channels, looking each one
+// up first so sections carry the channel name and forum channels are handled
+// under --threads. Channels the token cannot read, or that were never reached
+// because ctx was canceled, are reported as skipped.
+func (c *DiscordClient) ScrapeChannels(ctx context.Context, opts *scrapeOptions, sp *spool, channelIDs []string, concurrency int) ([]ChannelExport, []SkippedChannel, Stats, error) {
+	var stats Stats
+	var skipped []SkippedChannel
+	targets := make([]apiChannel, 0, len(channelIDs))
+	for _, id := range channelIDs {
+		ch, metrics, err := c.fetchChannel(ctx, id)
+		stats.addMetrics(metrics)
+		if err != nil {
+			if reason, ok := skipReason(ctx, err); ok {
+				skipped = append(skipped, SkippedChannel{ChannelID: id, Reason: reason})
+				continue
+			}
+			return nil, nil, stats, fmt.Errorf("fetch channel %s: %w", id, err)
+		}
+		targets = append(targets, ch)
+	}
+
+	sections, more, chStats, err := c.scrapeChannels(ctx, opts, sp, targets, concurrency)
+	stats.add(chStats)
+	return sections, append(skipped, more...), stats, err
+}
+
+// scrapeChannels runs up to concurrency channel scrapes at once against the
+// shared client, all spooling into sp. Sections come back in target order regardless of which
+// worker finished first; the first hard error is returned after all workers
+// have stopped. Cancellation is not an error: channels cut short come back as
+// partial sections and channels never started as skipped.
+func (c *DiscordClient) scrapeChannels(ctx context.Context, opts *scrapeOptions, sp *spool, targets []apiChannel, concurrency int) ([]ChannelExport, []SkippedChannel, Stats, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	concurrency = min(concurrency, len(targets))
+
+	results := make([]channelResult, len(targets))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Go(func() {
+			for i := range jobs {
+				results[i] = c.scrapeTarget(ctx, opts, sp, &targets[i], concurrency > 1)
+			}
+		})
+	}
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var stats Stats
+	var sections []ChannelExport
+	var skipped []SkippedChannel
+	var firstErr error
+	for i := range results {
+		res := &results[i]
+		stats.add(res.section.Stats)
+		switch {
+		case res.err != nil:
+			if firstErr == nil {
+				firstErr = res.err
+			}
+		case res.skipped != nil:
+			skipped = append(skipped, *res.skipped)
+		default:
+			sections = append(sections, res.section)
+		}
+	}
+	if firstErr != nil {
+		return nil, nil, stats, firstErr
+	}
+	return sections, skipped, stats, nil
+}
+
+// scrapeTarget scrapes one channel (and its threads under --threads). When
+// other channels run in parallel the per-batch progress lines would
+// interleave, so they are replaced by a single line once the channel is done.
+func (c *DiscordClient) scrapeTarget(ctx context.Context, opts *scrapeOptions, sp *spool, ch *apiChannel, parallel bool) channelResult {
+	if ctx.Err() != nil {
+		return channelResult{skipped: &SkippedChannel{ChannelID: ch.ID, Name: ch.Name, Reason: "interrupted"}}
+	}
+
+	chOpts := *opts
+	chOpts.ChannelID = ch.ID
+	chOpts.Quiet = opts.Quiet || parallel
+	if !chOpts.Quiet {
+		fmt.Printf("scraping #%s (%s)\n", ch.Name, ch.ID)
+	}
+
+	var src *spoolSource
+	var stats Stats
+	var err error
+	if opts.Threads {
+		src, stats, err = c.scrapeChannelTree(ctx, &chOpts, ch, sp)
+	} else {
+		src = &spoolSource{own: sp.newStream()}
+		src.count, stats, err = c.ScrapeChannel(ctx, &chOpts, src.own)
+	}
+
+	res := channelResult{section: ChannelExport{ChannelID: ch.ID, GuildID: ch.GuildID, Name: ch.Name, Stats: stats}}
+	if before, ok := interruptedBefore(err); ok {
+		res.section.Partial = true
+		res.section.StoppedBefore = before
+	} else if err != nil {
+		if reason, ok := skipReason(ctx, err); ok {
+			res.skipped = &SkippedChannel{ChannelID: ch.ID, Name: ch.Name, Reason: reason}
+			return res
+		}
+		res.err = fmt.Errorf("channel %s: %w", ch.ID, err)
+		return res
+	}
+
+	res.section.source = src
+	res.section.MessageCount = src.len()
+	if parallel && !opts.Quiet {
+		fmt.Printf("finished #%s (%s): %d messages\n", ch.Name, ch.ID, src.len())
+	}
+	return res
+}
+
+// skipReason classifies errors that should skip a channel rather than fail
+// the whole run.
+func skipReason(ctx context.Context, err error) (string, bool) {
+	switch {
+	case isAccessDenied(err):
+		return "missing access", true
+	case ctx.Err() != nil:
+		return "interrupted", true
+	}
+	return "", false
+}
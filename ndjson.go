@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ndjsonHeader and ndjsonTrailer bracket the message lines of an NDJSON
+// export. Message lines carry no "record" key, so `select(.record == null)`
+// (or --ndjson-meta=false) leaves only messages.
+type ndjsonHeader struct {
+	Record     string        `json:"record"`
+	GuildID    string        `json:"guild_id,omitempty"`
+	ChannelID  string        `json:"channel_id,omitempty"`
+	ExportedAt time.Time     `json:"exported_at"`
+	Filters    FilterSummary `json:"filters"`
+}
+
+type ndjsonTrailer struct {
+	Record        string             `json:"record"`
+	MessageCount  int                `json:"message_count"`
+	Partial       bool               `json:"partial,omitempty"`
+	StoppedBefore string             `json:"stopped_before,omitempty"`
+	Skipped       []SkippedChannel   `json:"skipped_channels,omitempty"`
+	Stats         Stats              `json:"stats"`
+	Indicators    []IndicatorSummary `json:"indicators,omitempty"`
+}
+
+// writeNDJSONFile writes an NDJSON export to path, or to stdout when path is
+// stdoutOutput.
+func writeNDJSONFile(path string, export *Export, meta bool) (err error) {
+	if path == stdoutOutput {
+		return writeNDJSON(os.Stdout, export, meta)
+	}
+	file, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := file.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	return writeNDJSON(file, export, meta)
+}
+
+// writeNDJSON writes one compact Message per line in chronological order
+// (channel by channel for sectioned exports), optionally preceded by a
+// header line with the filters and followed by a trailer with the stats.
+func writeNDJSON(out io.Writer, export *Export, meta bool) error {
+	w := bufio.NewWriter(out)
+	enc := json.NewEncoder(w)
+
+	if meta {
+		header := ndjsonHeader{
+			Record:     "header",
+			GuildID:    export.GuildID,
+			ChannelID:  export.ChannelID,
+			ExportedAt: export.ExportedAt,
+			Filters:    export.Filters,
+		}
+		if err := enc.Encode(&header); err != nil {
+			return err
+		}
+	}
+
+	err := forEachMessage(export, func(_ *ChannelExport, msg *Message) error {
+		return enc.Encode(msg)
+	})
+	if err != nil {
+		return err
+	}
+
+	if meta {
+		trailer := ndjsonTrailer{
+			Record:        "trailer",
+			MessageCount:  export.MessageCount,
+			Partial:       export.Partial,
+			StoppedBefore: export.StoppedBefore,
+			Skipped:       export.Skipped,
+			Stats:         export.Stats,
+			Indicators:    export.Indicators,
+		}
+		if err := enc.Encode(&trailer); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// queryResult is what a query collected from its input exports.
+type queryResult struct {
+	matches []Message
+	// names maps channel IDs to the names recorded in sectioned exports.
+	names   map[string]string
+	guildID string
+	files   int
+	scanned int
+}
+
+// runQuery implements `ripcord query <export.json|dir>...`: it searches
+// existing exports offline with the same filters a scrape applies, then
+// prints the matches or re-exports them through writeOutputs.
+func runQuery(args []string) error {
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	var keywords, users, columns multiValue
+	flags.Var(&keywords, "keyword", "Case-insensitive keyword filter (repeatable)")
+	flags.Var(&users, "user", "Filter by username, display name or ID (repeatable)")
+	query := flags.String("query", "", "Boolean filter expression (same syntax as the scrape --query)")
+	var regexes, excludeKeywords, excludeUsers multiValue
+	flags.Var(&regexes, "regex", "Regular expression the content must match (repeatable, OR-matched)")
+	flags.Var(&excludeKeywords, "exclude-keyword", "Drop messages containing this keyword (repeatable)")
+	flags.Var(&excludeUsers, "exclude-user", "Drop messages from this username or ID (repeatable)")
+	var types multiValue
+	flags.Var(&types, "type", `Message types to keep, by name or number (repeatable; "system" for all events)`)
+	daysBack := flags.Int("days", 0, "Only messages from the last n days")
+	hoursBack := flags.Int("hours", 0, "Only messages from the last n hours")
+	rangeStr := flags.String("range", "", "Absolute window start,end (RFC3339)")
+	maxMessages := flags.Int("max", 0, "Keep only the newest n matches (0 = unlimited)")
+	format := flags.String("format", "json", "Re-export format when --output is set")
+	output := flags.String("output", "", "Re-export matches with this prefix instead of printing them (- streams ndjson to stdout)")
+	flags.Var(&columns, "columns", "CSV/TSV columns to write, in order (default all)")
+	ndjsonMeta := flags.Bool("ndjson-meta", true, "Wrap NDJSON messages in header/trailer lines")
+	extractIndicators := flags.Bool("extract-indicators", false, "Extract indicators from the matches when re-exporting")
+	indicatorsFile := flags.String("indicators-file", "", "Also write the matches' indicators to <prefix>_indicators.json or .csv")
+	sign := flags.Bool("sign", false, "Sign the re-exported files with the key from `ripcord keygen`")
+	quiet := flags.Bool("quiet", false, "Only print matches and errors")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("usage: ripcord query [filters] [--output <prefix> --format <fmt>] <export.json|dir>...")
+	}
+
+	fmtChoice, err := normalizeFormat(*format)
+	if err != nil {
+		return err
+	}
+	if err := validateOutput(*output, fmtChoice, false); err != nil {
+		return err
+	}
+	if err := validateIndicatorsFile(*indicatorsFile, *output); err != nil {
+		return err
+	}
+	if *sign && *output == "" {
+		return errors.New("--sign needs --output; printed matches cannot be signed")
+	}
+	signingKey, err := resolveSigningKey(*sign, *output)
+	if err != nil {
+		return err
+	}
+	columnNames := splitValues(columns)
+	if _, err := selectCSVColumns(columnNames); err != nil {
+		return fmt.Errorf("invalid --columns value: %w", err)
+	}
+	if strings.TrimSpace(*output) == stdoutOutput {
+		*quiet = true
+	}
+
+	typeNames, err := normalizeMessageTypes(types)
+	if err != nil {
+		return fmt.Errorf("invalid --type value: %w", err)
+	}
+	opts := scrapeOptions{
+		Keywords:        normalizeStringList(keywords),
+		Users:           normalizeStringList(users),
+		Query:           strings.TrimSpace(*query),
+		Regexes:         regexes,
+		ExcludeKeywords: normalizeStringList(excludeKeywords),
+		ExcludeUsers:    normalizeStringList(excludeUsers),
+		Types:           typeNames,
+		MaxMessages:     *maxMessages,
+	}
+	if opts.filter, err = compileFilter(&opts); err != nil {
+		return err
+	}
+	if *rangeStr != "" || *daysBack > 0 || *hoursBack > 0 {
+		if opts.Since, opts.Until, err = resolveTimeWindow(*rangeStr, *daysBack, *hoursBack); err != nil {
+			return err
+		}
+	}
+
+	paths, err := expandExportPaths(flags.Args())
+	if err != nil {
+		return err
+	}
+	res, err := queryExports(paths, &opts)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		printMatches(res)
+	} else {
+		export := res.export(&opts)
+		cfg := &runConfig{
+			OutputPrefix: *output,
+			Format:       fmtChoice,
+			Quiet:        *quiet,
+			NDJSONMeta:   *ndjsonMeta,
+			Columns:      columnNames,
+
+			ExtractIndicators: *extractIndicators,
+			IndicatorsFile:    *indicatorsFile,
+			SigningKey:        signingKey,
+		}
+		outputs, err := writeOutputs(&export, cfg)
+		if err == nil {
+			outputs, err = finishOutputs(&export, cfg, outputs)
+		}
+		if err != nil {
+			return fmt.Errorf("write export: %w", err)
+		}
+		if !*quiet {
+			fmt.Printf("wrote %d messages to %s\n", len(res.matches), strings.Join(outputs, ", "))
+		}
+	}
+	if !*quiet {
+		fmt.Fprintf(os.Stderr, "%d of %d messages matched across %d exports\n", len(res.matches), res.scanned, res.files)
+	}
+	return nil
+}
+
+// expandExportPaths turns the command's arguments into export files,
+// walking directories for *.json exports (see isExportFile).
+func expandExportPaths(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if !isExportFile(d.Name()) {
+				return nil
+			}
+			paths = append(paths, path)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("no exports found")
+	}
+	return paths, nil
+}
+
+// isExportFile reports whether a file found while walking a directory is a
+// ripcord JSON export rather than one of the other JSON files written next to
+// it: --split index manifests, checkpoints, indicator lists, manifests,
+// STIX bundles and MISP events, none of which hold messages.
+func isExportFile(name string) bool {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".json") {
+		return false
+	}
+	for _, suffix := range []string{"_index.json", checkpointSuffix, "_indicators.json", manifestSuffix, stixExtension, mispExtension} {
+		if strings.HasSuffix(name, suffix) {
+			return false
+		}
+	}
+	return true
+}
+
+// queryExports loads each export in turn and keeps the messages that pass
+// the filters, dropping duplicates seen in overlapping exports. Matches are
+// returned oldest-first, trimmed to the newest opts.MaxMessages.
+func queryExports(paths []string, opts *scrapeOptions) (*queryResult, error) {
+	res := &queryResult{names: make(map[string]string)}
+	seen := make(map[string]struct{})
+	guilds := make(map[string]struct{})
+
+	for _, path := range paths {
+		export, err := loadExport(path)
+		if err != nil {
+			return nil, fmt.Errorf("load export: %w", err)
+		}
+		res.files++
+		guilds[export.GuildID] = struct{}{}
+		for i := range export.Channels {
+			res.names[export.Channels[i].ChannelID] = export.Channels[i].Name
+		}
+
+		err = forEachMessage(export, func(_ *ChannelExport, msg *Message) error {
+			res.scanned++
+			if _, dup := seen[msg.ID]; dup {
+				return nil
+			}
+			if afterUntil(opts, msg.Timestamp) || beforeSince(opts, msg.Timestamp) || !messagePassesFilters(msg, opts) {
+				return nil
+			}
+			seen[msg.ID] = struct{}{}
+			res.matches = append(res.matches, *msg)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(guilds) == 1 {
+		for id := range guilds {
+			res.guildID = id
+		}
+	}
+	sort.SliceStable(res.matches, func(i, j int) bool {
+		return messageBefore(&res.matches[i], &res.matches[j])
+	})
+	if opts.MaxMessages > 0 && len(res.matches) > opts.MaxMessages {
+		res.matches = res.matches[len(res.matches)-opts.MaxMessages:]
+	}
+	return res, nil
+}
+
+// export packages the matches like a scrape would: a single-channel export
+// when they all come from one channel (threads included), otherwise one
+// section per channel in order of first match.
+func (res *queryResult) export(opts *scrapeOptions) Export {
+	export := Export{
+		ExportedAt:   time.Now().UTC(),
+		MessageCount: len(res.matches),
+		Filters:      newFilterSummary(opts),
+	}
+
+	var order []string
+	sections := make(map[string][]Message)
+	for i := range res.matches {
+		id := sectionChannelID(&res.matches[i])
+		if _, ok := sections[id]; !ok {
+			order = append(order, id)
+		}
+		sections[id] = append(sections[id], res.matches[i])
+	}
+
+	export.GuildID = res.guildID
+	if len(order) == 1 {
+		export.ChannelID = order[0]
+		export.Messages = sections[order[0]]
+		return export
+	}
+	for _, id := range order {
+		export.Channels = append(export.Channels, ChannelExport{
+			ChannelID:    id,
+			Name:         res.names[id],
+			MessageCount: len(sections[id]),
+			Messages:     sections[id],
+		})
+	}
+	return export
+}
+
+// sectionChannelID files thread messages under their parent channel.
+func sectionChannelID(msg *Message) string {
+	if msg.ParentChannelID != "" {
+		return msg.ParentChannelID
+	}
+	return msg.ChannelID
+}
+
+func printMatches(res *queryResult) {
+	for i := range res.matches {
+		msg := &res.matches[i]
+		channel := msg.ChannelID
+		if name := res.names[sectionChannelID(msg)]; name != "" {
+			channel = name
+		}
+		if msg.ThreadName != "" {
+			channel += "/" + msg.ThreadName
+		}
+		content := strings.Join(strings.Fields(msg.Content), " ")
+		fmt.Printf("%s #%s %s: %s\n", msg.Timestamp.Format(time.RFC3339), channel, describeAuthor(&msg.Author), content)
+	}
+}
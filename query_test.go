@@ -0,0 +1,199 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+var queryEpoch = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func queryMessage(id, channelID, user, content string, minute int) Message {
+	return Message{
+		ID:        id,
+		ChannelID: channelID,
+		Author:    Author{ID: "u-" + user, Username: user},
+		Content:   content,
+		Timestamp: queryEpoch.Add(time.Duration(minute) * time.Minute),
+	}
+}
+
+func writeQueryExport(t *testing.T, dir, name string, export *Export) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := writeJSON(path, export); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func matchIDs(res *queryResult) []string {
+	ids := make([]string, len(res.matches))
+	for i := range res.matches {
+		ids[i] = res.matches[i].ID
+	}
+	return ids
+}
+
+func TestQueryExportsDropsOverlap(t *testing.T) {
+	dir := t.TempDir()
+	older := writeQueryExport(t, dir, "older.json", &Export{
+		GuildID:   "g1",
+		ChannelID: "c1",
+		Messages: []Message{
+			queryMessage("1", "c1", "alice", "first", 1),
+			queryMessage("2", "c1", "bob", "second", 2),
+		},
+	})
+	newer := writeQueryExport(t, dir, "newer.json", &Export{
+		GuildID:   "g1",
+		ChannelID: "c1",
+		Messages: []Message{
+			queryMessage("2", "c1", "bob", "second", 2),
+			queryMessage("3", "c1", "alice", "third", 3),
+		},
+	})
+
+	// Newest export first: matches still come back oldest-first.
+	res, err := queryExports([]string{newer, older}, &scrapeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := matchIDs(res), []string{"1", "2", "3"}; !slices.Equal(got, want) {
+		t.Errorf("matches = %v, want %v", got, want)
+	}
+	if res.files != 2 || res.scanned != 4 {
+		t.Errorf("scanned %d messages in %d files, want 4 in 2", res.scanned, res.files)
+	}
+	if res.guildID != "g1" {
+		t.Errorf("guildID = %q, want g1", res.guildID)
+	}
+}
+
+func TestQueryExportsFilters(t *testing.T) {
+	dir := t.TempDir()
+	since, until := queryEpoch.Add(2*time.Minute), queryEpoch.Add(4*time.Minute)
+	path := writeQueryExport(t, dir, "export.json", &Export{
+		ChannelID: "c1",
+		Messages: []Message{
+			queryMessage("1", "c1", "alice", "Deploy went fine", 1),
+			queryMessage("2", "c1", "bob", "deploy failed", 2),
+			queryMessage("3", "c1", "alice", "lunch?", 3),
+			queryMessage("4", "c1", "alice", "DEPLOY again", 4),
+			queryMessage("5", "c1", "alice", "deploy once more", 5),
+		},
+	})
+
+	tests := []struct {
+		name string
+		opts scrapeOptions
+		want []string
+	}{
+		{"no filters", scrapeOptions{}, []string{"1", "2", "3", "4", "5"}},
+		{"keyword", scrapeOptions{Keywords: []string{"deploy"}}, []string{"1", "2", "4", "5"}},
+		{"user", scrapeOptions{Users: []string{"bob"}}, []string{"2"}},
+		{"keyword and user", scrapeOptions{Keywords: []string{"deploy"}, Users: []string{"alice"}}, []string{"1", "4", "5"}},
+		{"max keeps newest", scrapeOptions{Keywords: []string{"deploy"}, MaxMessages: 2}, []string{"4", "5"}},
+		{"window", scrapeOptions{Since: &since, Until: &until}, []string{"2", "3", "4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := compileFilter(&tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.opts.filter = filter
+			res, err := queryExports([]string{path}, &tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := matchIDs(res); !slices.Equal(got, tt.want) {
+				t.Errorf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryResultExportSections(t *testing.T) {
+	dir := t.TempDir()
+	thread := queryMessage("3", "t1", "bob", "in a thread", 3)
+	thread.ParentChannelID, thread.ThreadName = "c1", "standup"
+	path := writeQueryExport(t, dir, "guild.json", &Export{
+		GuildID: "g1",
+		Channels: []ChannelExport{
+			{ChannelID: "c2", Name: "random", Messages: []Message{queryMessage("2", "c2", "alice", "hello", 2)}},
+			{ChannelID: "c1", Name: "general", Messages: []Message{queryMessage("1", "c1", "alice", "hi", 1), thread}},
+		},
+	})
+
+	res, err := queryExports([]string{path}, &scrapeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	export := res.export(&scrapeOptions{})
+	if export.GuildID != "g1" || export.MessageCount != 3 {
+		t.Errorf("export guild %q count %d, want g1 3", export.GuildID, export.MessageCount)
+	}
+	if len(export.Channels) != 2 {
+		t.Fatalf("export has %d sections, want 2", len(export.Channels))
+	}
+	// Sections follow first match, and the thread files under its parent.
+	general, random := export.Channels[0], export.Channels[1]
+	if general.ChannelID != "c1" || general.Name != "general" || general.MessageCount != 2 {
+		t.Errorf("first section = %s %q with %d messages, want c1 \"general\" with 2", general.ChannelID, general.Name, general.MessageCount)
+	}
+	if random.ChannelID != "c2" || random.Name != "random" || random.MessageCount != 1 {
+		t.Errorf("second section = %s %q with %d messages, want c2 \"random\" with 1", random.ChannelID, random.Name, random.MessageCount)
+	}
+
+	// Narrowing to one channel, thread included, gives a flat export.
+	bob := scrapeOptions{Users: []string{"bob"}}
+	if bob.filter, err = compileFilter(&bob); err != nil {
+		t.Fatal(err)
+	}
+	res, err = queryExports([]string{path}, &bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	single := res.export(&scrapeOptions{})
+	if single.ChannelID != "c1" || len(single.Channels) != 0 || len(single.Messages) != 1 {
+		t.Errorf("single-channel export = channel %q, %d sections, %d messages; want c1, 0, 1", single.ChannelID, len(single.Channels), len(single.Messages))
+	}
+}
+
+func TestExpandExportPathsSkipsIndexAndCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	nested := filepath.Join(dir, "nested")
+	if err := os.Mkdir(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"run.json",
+		"run_index.json",
+		"run.md",
+		"run" + checkpointSuffix,
+		filepath.Join("nested", "other.JSON"),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths, err := expandExportPaths([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(nested, "other.JSON"), filepath.Join(dir, "run.json")}
+	if !slices.Equal(paths, want) {
+		t.Errorf("paths = %v, want %v", paths, want)
+	}
+
+	if _, err := expandExportPaths([]string{filepath.Join(nested, "missing.json")}); err == nil {
+		t.Error("missing file did not error")
+	}
+	if _, err := expandExportPaths([]string{t.TempDir()}); err == nil {
+		t.Error("empty directory did not error")
+	}
+}
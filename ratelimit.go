@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter tracks Discord's per-route buckets from the X-RateLimit-*
+// response headers and delays requests before a bucket runs dry, so the
+// client waits proactively instead of collecting 429s. It is shared by every
+// goroutine using a DiscordClient, and additionally spaces all requests to
+// stay under a token-wide budget of globalRateLimit requests per second.
+//
+// Routes map to bucket hashes via X-RateLimit-Bucket; a bucket is scoped to
+// its major parameter (channel or guild ID), so the state key is the hash
+// plus that ID. Until a route's first response names its bucket, the route
+// itself is used as the key.
+type rateLimiter struct {
+	mu          sync.Mutex
+	routes      map[string]string
+	buckets     map[string]*bucketState
+	globalUntil time.Time
+	interval    time.Duration
+	nextSlot    time.Time
+}
+
+type bucketState struct {
+	limit     int
+	remaining int
+	resetAt   time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		routes:   make(map[string]string),
+		buckets:  make(map[string]*bucketState),
+		interval: time.Duration(float64(time.Second) / globalRateLimit),
+	}
+}
+
+// wait blocks until a request on route is allowed or ctx is canceled. It
+// returns the total time slept and whether any of it was a proactive wait on
+// an exhausted bucket or global limit (as opposed to routine spacing under
+// the shared budget).
+func (l *rateLimiter) wait(ctx context.Context, route string) (time.Duration, bool, error) {
+	var slept time.Duration
+	proactive := false
+	for {
+		l.mu.Lock()
+		delay, granted := l.reserve(route, time.Now())
+		l.mu.Unlock()
+
+		if delay > 0 {
+			if err := sleepContext(ctx, delay); err != nil {
+				return slept, proactive, err
+			}
+			slept += delay
+		}
+		if granted {
+			return slept, proactive, nil
+		}
+		proactive = true
+	}
+}
+
+// reserve either grants a request slot (returning the spacing delay before
+// it may be sent) or reports how long to wait before trying again. Callers
+// must hold l.mu.
+func (l *rateLimiter) reserve(route string, now time.Time) (time.Duration, bool) {
+	if now.Before(l.globalUntil) {
+		return l.globalUntil.Sub(now), false
+	}
+
+	if b := l.buckets[l.bucketKey(route)]; b != nil {
+		if !b.resetAt.IsZero() && !now.Before(b.resetAt) {
+			b.remaining = b.limit
+			b.resetAt = time.Time{}
+		}
+		if b.remaining <= 0 && !b.resetAt.IsZero() {
+			return b.resetAt.Sub(now), false
+		}
+		if b.remaining > 0 {
+			b.remaining--
+		}
+	}
+
+	slot := now
+	if l.nextSlot.After(slot) {
+		slot = l.nextSlot
+	}
+	l.nextSlot = slot.Add(l.interval)
+	return slot.Sub(now), true
+}
+
+// update records the bucket headers from a response on route.
+func (l *rateLimiter) update(route string, header http.Header) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if hash := header.Get("X-RateLimit-Bucket"); hash != "" {
+		l.routes[route] = hash
+	}
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	resetAfter, err := strconv.ParseFloat(header.Get("X-RateLimit-Reset-After"), 64)
+	if err != nil {
+		return
+	}
+	limit, err := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	if err != nil || limit < remaining {
+		limit = remaining + 1
+	}
+
+	key := l.bucketKey(route)
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucketState{}
+		l.buckets[key] = b
+	}
+	b.limit = limit
+	b.remaining = remaining
+	b.resetAt = time.Now().Add(time.Duration(resetAfter * float64(time.Second)))
+}
+
+// block marks route (or every route, when global) as exhausted for d after
+// a 429 so later requests honor the server's retry_after.
+func (l *rateLimiter) block(route string, d time.Duration, global bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if global {
+		if until.After(l.globalUntil) {
+			l.globalUntil = until
+		}
+		return
+	}
+	key := l.bucketKey(route)
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucketState{limit: 1}
+		l.buckets[key] = b
+	}
+	b.remaining = 0
+	b.resetAt = until
+}
+
+// bucketKey resolves route to its bucket state key. Callers must hold l.mu.
+func (l *rateLimiter) bucketKey(route string) string {
+	hash, ok := l.routes[route]
+	if !ok {
+		return route
+	}
+	return hash + ":" + majorParameter(route)
+}
+
+// rateLimitRoute reduces an endpoint URL to its rate limit route: the path
+// with the major parameter kept and any other snowflakes collapsed.
+func rateLimitRoute(endpoint string) string {
+	path := strings.TrimPrefix(endpoint, apiBase)
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := range parts {
+		if i == 1 && (parts[0] == "channels" || parts[0] == "guilds") {
+			continue
+		}
+		if isSnowflake(parts[i]) {
+			parts[i] = ":id"
+		}
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+func majorParameter(route string) string {
+	parts := strings.Split(strings.Trim(route, "/"), "/")
+	if len(parts) > 1 && (parts[0] == "channels" || parts[0] == "guilds") {
+		return parts[1]
+	}
+	return ""
+}
+
+func isSnowflake(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isGlobalRateLimit reports whether a 429 applies to the whole token rather
+// than one bucket.
+func isGlobalRateLimit(header http.Header, body []byte) bool {
+	if strings.EqualFold(header.Get("X-RateLimit-Global"), "true") {
+		return true
+	}
+	var payload struct {
+		Global bool `json:"global"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return false
+	}
+	return payload.Global
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimitRoute(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{apiBase + "/channels/123/messages?limit=100&before=999", "/channels/123/messages"},
+		{apiBase + "/channels/123/messages/456", "/channels/123/messages/:id"},
+		{apiBase + "/channels/123/threads/archived/public", "/channels/123/threads/archived/public"},
+		{apiBase + "/guilds/77/channels", "/guilds/77/channels"},
+		{apiBase + "/users/@me", "/users/@me"},
+	}
+	for _, tt := range tests {
+		if got := rateLimitRoute(tt.endpoint); got != tt.want {
+			t.Errorf("rateLimitRoute(%q) = %q, want %q", tt.endpoint, got, tt.want)
+		}
+	}
+}
+
+func bucketHeader(bucket, remaining, resetAfter string) http.Header {
+	h := http.Header{}
+	h.Set("X-RateLimit-Bucket", bucket)
+	h.Set("X-RateLimit-Limit", "5")
+	h.Set("X-RateLimit-Remaining", remaining)
+	h.Set("X-RateLimit-Reset-After", resetAfter)
+	return h
+}
+
+func TestRateLimiterBucketsSharedByHashAndMajorParameter(t *testing.T) {
+	l := newRateLimiter()
+	messages := "/channels/1/messages"
+	message := "/channels/1/messages/:id"
+	other := "/channels/2/messages"
+
+	l.update(messages, bucketHeader("abc", "4", "1"))
+	l.update(message, bucketHeader("abc", "0", "1"))
+	l.update(other, bucketHeader("abc", "3", "1"))
+
+	if l.bucketKey(messages) != l.bucketKey(message) {
+		t.Errorf("routes in the same bucket and channel have keys %q and %q", l.bucketKey(messages), l.bucketKey(message))
+	}
+	if l.bucketKey(messages) == l.bucketKey(other) {
+		t.Errorf("channels 1 and 2 share bucket state %q", l.bucketKey(other))
+	}
+	if b := l.buckets[l.bucketKey(messages)]; b.remaining != 0 {
+		t.Errorf("shared bucket has %d remaining, want the latest response's 0", b.remaining)
+	}
+	if unknown := "/guilds/9/channels"; l.bucketKey(unknown) != unknown {
+		t.Errorf("route with no bucket yet keyed as %q", l.bucketKey(unknown))
+	}
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	l := newRateLimiter()
+	route := "/channels/1/messages"
+	now := time.Now()
+
+	if delay, granted := l.reserve(route, now); delay != 0 || !granted {
+		t.Errorf("first request: delay %v granted %v, want 0 true", delay, granted)
+	}
+	// Every route shares the token-wide budget, so a second request at the
+	// same instant is spaced one interval later even on another route.
+	if delay, granted := l.reserve("/guilds/9/channels", now); delay != l.interval || !granted {
+		t.Errorf("second request: delay %v granted %v, want %v true", delay, granted, l.interval)
+	}
+
+	l.update(route, bucketHeader("abc", "1", "60"))
+	later := now.Add(time.Second)
+	if _, granted := l.reserve(route, later); !granted {
+		t.Error("request with one left in the bucket was refused")
+	}
+	delay, granted := l.reserve(route, later.Add(time.Second))
+	if granted || delay < 50*time.Second {
+		t.Errorf("request on an exhausted bucket: delay %v granted %v, want about a minute and false", delay, granted)
+	}
+	if _, granted := l.reserve(route, later.Add(2*time.Minute)); !granted {
+		t.Error("request after the bucket reset was refused")
+	}
+}
+
+func TestRateLimiterBlock(t *testing.T) {
+	l := newRateLimiter()
+	now := time.Now().Add(time.Second)
+	l.block("/channels/1/messages", time.Minute, false)
+	if _, granted := l.reserve("/channels/2/messages", now); !granted {
+		t.Error("a 429 on one route blocked another")
+	}
+	if _, granted := l.reserve("/channels/1/messages", now); granted {
+		t.Error("route was granted before its retry_after")
+	}
+
+	l.block("/channels/1/messages", time.Minute, true)
+	if delay, granted := l.reserve("/guilds/9/channels", now.Add(time.Second)); granted || delay < 50*time.Second {
+		t.Errorf("global 429: delay %v granted %v on another route, want about a minute and false", delay, granted)
+	}
+}
+
+func TestRateLimiterWaitReportsProactiveWaits(t *testing.T) {
+	l := newRateLimiter()
+	route := "/channels/1/messages"
+	ctx := context.Background()
+	if _, proactive, err := l.wait(ctx, route); err != nil || proactive {
+		t.Errorf("first request: proactive %v err %v, want false nil", proactive, err)
+	}
+	l.update(route, bucketHeader("abc", "0", "0.05"))
+	slept, proactive, err := l.wait(ctx, route)
+	if err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if !proactive || slept < 30*time.Millisecond {
+		t.Errorf("exhausted bucket: slept %v proactive %v, want its reset and true", slept, proactive)
+	}
+}
+
+func TestRateLimiterWaitCanceled(t *testing.T) {
+	l := newRateLimiter()
+	route := "/channels/1/messages"
+	l.update(route, bucketHeader("abc", "0", "60"))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if _, _, err := l.wait(ctx, route); err == nil {
+		t.Fatal("wait on a canceled context returned no error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("canceled wait took %v, want it to return promptly", elapsed)
+	}
+}
+
+func TestIsGlobalRateLimit(t *testing.T) {
+	global := http.Header{}
+	global.Set("X-RateLimit-Global", "true")
+	tests := []struct {
+		header http.Header
+		body   string
+		want   bool
+	}{
+		{global, "", true},
+		{http.Header{}, `{"message": "You are being rate limited.", "retry_after": 1.5, "global": true}`, true},
+		{http.Header{}, `{"message": "You are being rate limited.", "retry_after": 1.5, "global": false}`, false},
+		{http.Header{}, `not json`, false},
+	}
+	for _, tt := range tests {
+		if got := isGlobalRateLimit(tt.header, []byte(tt.body)); got != tt.want {
+			t.Errorf("isGlobalRateLimit(%v, %q) = %v, want %v", tt.header, tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Signatures are Ed25519ph (RFC 8032): the file is hashed with SHA-512 and
+// the digest signed, so large exports never have to be held in memory.
+var signatureOptions = &ed25519.Options{Hash: crypto.SHA512}
+
+// runKeygen implements `ripcord keygen`: it creates the Ed25519 keypair
+// --sign uses, under the user's config directory. An existing key is kept
+// unless --force is given, since replacing it orphans earlier signatures.
+func runKeygen(args []string) error {
+	flags := flag.NewFlagSet("keygen", flag.ExitOnError)
+	force := flags.Bool("force", false, "Replace an existing signing key")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	privPath, pubPath, err := signingKeyPaths()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(privPath); err == nil && !*force {
+		return fmt.Errorf("a signing key already exists at %s (pass --force to replace it)", privPath)
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(privPath), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Clean(privPath), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0o600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Clean(pubPath), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o600); err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ Signing key written to %s\n", privPath)
+	fmt.Printf("Public key (share with whoever verifies your exports): %s\n", pubPath)
+	fmt.Printf("Fingerprint: %s\n", keyFingerprint(pub))
+	return nil
+}
+
+// signingKeyPaths returns where keygen keeps the private and public key.
+func signingKeyPaths() (string, string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", "", fmt.Errorf("resolve config dir: %w", err)
+	}
+	priv := filepath.Join(configDir, signingKeyDir, signingKeyFile)
+	return priv, priv + ".pub", nil
+}
+
+// resolveSigningKey loads the private key when --sign is set, so a missing
+// key fails the run before anything is scraped.
+func resolveSigningKey(sign bool, output string) (ed25519.PrivateKey, error) {
+	if !sign {
+		return nil, nil
+	}
+	if strings.TrimSpace(output) == stdoutOutput {
+		return nil, errors.New("--sign needs files to sign and cannot be used with --output -")
+	}
+	path, _, err := signingKeyPaths()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errors.New("no signing key found (run `ripcord keygen` first)")
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s is not a PEM private key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 key", path)
+	}
+	return priv, nil
+}
+
+// loadPublicKey reads a PEM public key as written by keygen.
+func loadPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("%s is not a PEM public key", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 key", path)
+	}
+	return pub, nil
+}
+
+// keyFingerprint identifies a public key in manifests and verify output,
+// in the style of ssh-keygen -l.
+func keyFingerprint(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// signFiles writes a detached signature next to each file and returns their
+// paths.
+func signFiles(key ed25519.PrivateKey, files []string) ([]string, error) {
+	var sigs []string
+	for _, file := range files {
+		if file == stdoutOutput {
+			continue
+		}
+		sig, err := signFile(key, file)
+		if err != nil {
+			return nil, fmt.Errorf("sign %s: %w", file, err)
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
+
+// signFile writes <path>.sig holding the base64 signature of the file.
+func signFile(key ed25519.PrivateKey, path string) (string, error) {
+	digest, err := fileDigest(path)
+	if err != nil {
+		return "", err
+	}
+	sig, err := key.Sign(nil, digest, signatureOptions)
+	if err != nil {
+		return "", err
+	}
+	sigPath := path + signatureSuffix
+	data := base64.StdEncoding.EncodeToString(sig) + "\n"
+	if err := os.WriteFile(filepath.Clean(sigPath), []byte(data), 0o600); err != nil {
+		return "", err
+	}
+	return sigPath, nil
+}
+
+// checkSignature describes what is wrong with the detached signature for
+// path, or returns "" when it verifies against pub.
+func checkSignature(pub ed25519.PublicKey, path string) string {
+	data, err := os.ReadFile(filepath.Clean(path + signatureSuffix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "not signed"
+	}
+	if err != nil {
+		return err.Error()
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return "unreadable signature"
+	}
+	digest, err := fileDigest(path)
+	if err != nil {
+		return err.Error()
+	}
+	if ed25519.VerifyWithOptions(pub, digest, sig, signatureOptions) != nil {
+		return "signature does not match the public key"
+	}
+	return ""
+}
+
+func fileDigest(path string) (digest []byte, err error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := file.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	h := sha512.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestConfigDir points the user config directory, where keygen keeps
+// the signing key, at a temporary directory.
+func useTestConfigDir(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("AppData", dir)
+}
+
+func TestSignAndVerifyRoundTrip(t *testing.T) {
+	useTestConfigDir(t)
+	if err := runKeygen(nil); err != nil {
+		t.Fatalf("keygen: %v", err)
+	}
+	if err := runKeygen(nil); err == nil {
+		t.Error("keygen replaced an existing key without --force")
+	}
+	_, pubPath, err := signingKeyPaths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := resolveSigningKey(true, "out.json")
+	if err != nil {
+		t.Fatalf("resolveSigningKey: %v", err)
+	}
+
+	// signedRun writes an export and one downloaded attachment, then signs
+	// them the way a --sign --download-attachments run does.
+	signedRun := func(t *testing.T) (manifest, export, attachment string) {
+		dir := t.TempDir()
+		prefix := filepath.Join(dir, "run")
+		export = prefix + ".json"
+		attachment = filepath.Join(prefix+attachmentDirSuffix, "a1_drop.bin")
+		if err := os.Mkdir(filepath.Dir(attachment), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		for path, data := range map[string]string{export: `{"messages": []}`, attachment: "abcd"} {
+			if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		cfg := &runConfig{OutputPrefix: export, DownloadAttachments: true, SigningKey: key}
+		outputs, err := finishOutputs(&Export{ChannelID: "100", ExportedAt: time.Now().UTC()}, cfg, []string{export})
+		if err != nil {
+			t.Fatalf("finishOutputs: %v", err)
+		}
+		manifest = prefix + manifestSuffix
+		for _, want := range []string{export + signatureSuffix, manifest, manifest + signatureSuffix} {
+			if !strings.Contains(strings.Join(outputs, "\n"), want) {
+				t.Errorf("outputs %v do not include %s", outputs, want)
+			}
+		}
+		if _, err := os.Stat(attachment + signatureSuffix); err == nil {
+			t.Error("attachment signed individually; the signed manifest covers it")
+		}
+		return manifest, export, attachment
+	}
+
+	tests := []struct {
+		name    string
+		tamper  func(t *testing.T, manifest, export, attachment string)
+		wantErr string
+	}{
+		{"untouched", func(*testing.T, string, string, string) {}, ""},
+		{"attachment modified", func(t *testing.T, _, _, attachment string) {
+			if err := os.WriteFile(attachment, []byte("abce"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}, "1 of "},
+		{"export modified", func(t *testing.T, _, export, _ string) {
+			if err := os.WriteFile(export, []byte(`{"messages": [1]}`), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}, "1 of "},
+		{"export signature removed", func(t *testing.T, _, export, _ string) {
+			if err := os.Remove(export + signatureSuffix); err != nil {
+				t.Fatal(err)
+			}
+		}, "2 of "},
+		{"manifest edited", func(t *testing.T, manifest, _, _ string) {
+			data, err := os.ReadFile(manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			edited := strings.Replace(string(data), `"channel_id": "100"`, `"channel_id": "200"`, 1)
+			if edited == string(data) {
+				t.Fatalf("no channel_id to edit in %s", data)
+			}
+			if err := os.WriteFile(manifest, []byte(edited), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}, "signature does not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, export, attachment := signedRun(t)
+			tt.tamper(t, manifest, export, attachment)
+			err := runVerify([]string{"--pubkey", pubPath, "--quiet", manifest})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("runVerify: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("runVerify = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("other key", func(t *testing.T) {
+		manifest, _, _ := signedRun(t)
+		useTestConfigDir(t)
+		if err := runKeygen(nil); err != nil {
+			t.Fatal(err)
+		}
+		_, otherPub, err := signingKeyPaths()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = runVerify([]string{"--pubkey", otherPub, "--quiet", manifest})
+		if err == nil || !strings.Contains(err.Error(), "signature does not match") {
+			t.Errorf("runVerify with another key = %v", err)
+		}
+	})
+}
+
+func TestResolveSigningKeyErrors(t *testing.T) {
+	useTestConfigDir(t)
+	if key, err := resolveSigningKey(false, "out.json"); key != nil || err != nil {
+		t.Errorf("resolveSigningKey without --sign = %v, %v", key, err)
+	}
+	if _, err := resolveSigningKey(true, stdoutOutput); err == nil {
+		t.Error("--sign accepted with --output -")
+	}
+	if _, err := resolveSigningKey(true, "out.json"); err == nil || !strings.Contains(err.Error(), "ripcord keygen") {
+		t.Errorf("missing key error = %v", err)
+	}
+}
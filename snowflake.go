@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// discordEpoch is the first millisecond of 2015, the zero point of the
+// timestamp encoded in the top 42 bits of every snowflake.
+const discordEpoch = 1420070400000
+
+// snowflakeFromTime returns the smallest snowflake that could have been
+// minted at t, suitable as a before/after pagination cursor.
+func snowflakeFromTime(t time.Time) string {
+	ms := t.UnixMilli() - discordEpoch
+	if ms < 0 {
+		ms = 0
+	}
+	return strconv.FormatUint(uint64(ms)<<22, 10)
+}
+
+// snowflakeLess orders Discord snowflake IDs numerically without parsing
+// them: IDs are decimal strings, so a shorter one is always smaller.
+func snowflakeLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// seekTracker estimates how many backward pages a seeded "before" cursor
+// avoided, by extrapolating the message density seen in the pages that were
+// actually fetched across the skipped span between until and now.
+type seekTracker struct {
+	until   time.Time
+	fetched int
+	newest  time.Time
+	oldest  time.Time
+}
+
+func (s *seekTracker) observe(batch []apiMessage) {
+	for i := range batch {
+		t, ok := parseMessageTime(batch[i].Timestamp)
+		if !ok {
+			continue
+		}
+		s.fetched++
+		if s.newest.IsZero() || t.After(s.newest) {
+			s.newest = t
+		}
+		if s.oldest.IsZero() || t.Before(s.oldest) {
+			s.oldest = t
+		}
+	}
+}
+
+func (s *seekTracker) savedRequests(now time.Time) int {
+	covered := s.newest.Sub(s.oldest)
+	skipped := now.Sub(s.until)
+	if s.fetched == 0 || covered <= 0 || skipped <= 0 {
+		return 0
+	}
+	perSecond := float64(s.fetched) / covered.Seconds()
+	return int(math.Ceil(perSecond * skipped.Seconds() / maxBatchSize))
+}
@@ -0,0 +1,309 @@
+package main
+
+// messageSource is one channel's messages in chronological order, either held
+// in memory (exports loaded from disk) or spooled to disk (live scrapes).
+type messageSource interface {
+	len() int
+	all() messageIter
+	// groups returns the channel's own messages followed by one iterator
+	// per thread, for writers that render threads as separate sections.
+	groups() []messageIter
+}
+
+// sliceSource adapts an in-memory message slice.
+type sliceSource []Message
+
+func (s sliceSource) len() int { return len(s) }
+
+func (s sliceSource) all() messageIter { return &sliceIter{messages: s} }
+
+func (s sliceSource) groups() []messageIter {
+	var own []*Message
+	var order []string
+	threads := make(map[string][]*Message)
+	for i := range s {
+		msg := &s[i]
+		if msg.ThreadName == "" && msg.ParentChannelID == "" {
+			own = append(own, msg)
+			continue
+		}
+		if _, ok := threads[msg.ChannelID]; !ok {
+			order = append(order, msg.ChannelID)
+		}
+		threads[msg.ChannelID] = append(threads[msg.ChannelID], msg)
+	}
+
+	iters := []messageIter{&ptrIter{messages: own}}
+	for _, id := range order {
+		iters = append(iters, &ptrIter{messages: threads[id]})
+	}
+	return iters
+}
+
+type ptrIter struct {
+	messages []*Message
+	idx      int
+}
+
+func (it *ptrIter) next() (*Message, error) {
+	if it.idx >= len(it.messages) {
+		return nil, nil
+	}
+	it.idx++
+	return it.messages[it.idx-1], nil
+}
+
+// spoolSource is a scraped channel: its own stream (nil for forum channels)
+// plus one stream per thread. When a message limit trimmed the merged view,
+// cutoff is the oldest message kept and older ones are hidden.
+type spoolSource struct {
+	own     *spoolStream
+	threads []threadStream
+	count   int
+	cutoff  *Message
+}
+
+type threadStream struct {
+	stream   *spoolStream
+	parentID string
+	name     string
+}
+
+func (s *spoolSource) len() int { return s.count }
+
+func (s *spoolSource) all() messageIter {
+	return newMergeIter(s.iters())
+}
+
+// groups orders threads by their first visible message, matching how the
+// in-memory grouping orders them by first appearance.
+func (s *spoolSource) groups() []messageIter {
+	iters := s.iters()
+	if s.own == nil {
+		iters = append([]messageIter{&sliceIter{}}, iters...)
+	}
+	own, threads := iters[0], iters[1:]
+
+	type firstSeen struct {
+		iter  *peekIter
+		first *Message
+	}
+	peeked := make([]firstSeen, 0, len(threads))
+	for _, it := range threads {
+		p := &peekIter{iter: it}
+		msg, err := p.peek()
+		if err != nil || msg != nil {
+			peeked = append(peeked, firstSeen{iter: p, first: msg})
+		}
+	}
+	for i := 1; i < len(peeked); i++ {
+		for j := i; j > 0 && peeked[j].first != nil && peeked[j-1].first != nil && messageBefore(peeked[j].first, peeked[j-1].first); j-- {
+			peeked[j], peeked[j-1] = peeked[j-1], peeked[j]
+		}
+	}
+
+	out := []messageIter{own}
+	for _, p := range peeked {
+		out = append(out, p.iter)
+	}
+	return out
+}
+
+func (s *spoolSource) iters() []messageIter {
+	var iters []messageIter
+	if s.own != nil {
+		iters = append(iters, s.filtered(s.own.reader(nil)))
+	}
+	for i := range s.threads {
+		t := s.threads[i]
+		iters = append(iters, s.filtered(t.stream.reader(func(msg *Message) {
+			msg.ParentChannelID = t.parentID
+			msg.ThreadName = t.name
+		})))
+	}
+	return iters
+}
+
+func (s *spoolSource) filtered(it messageIter) messageIter {
+	if s.cutoff == nil {
+		return it
+	}
+	return &cutoffIter{iter: it, cutoff: s.cutoff}
+}
+
+// limit keeps only the newest max messages across all streams.
+func (s *spoolSource) limit(maxMessages int) error {
+	total := 0
+	if s.own != nil {
+		total += s.own.count
+	}
+	for i := range s.threads {
+		total += s.threads[i].stream.count
+	}
+	s.count = total
+	if maxMessages <= 0 || total <= maxMessages {
+		return nil
+	}
+
+	it := s.all()
+	for skip := total - maxMessages; skip > 0; skip-- {
+		if _, err := it.next(); err != nil {
+			return err
+		}
+	}
+	first, err := it.next()
+	if err != nil {
+		return err
+	}
+	if first != nil {
+		kept := *first
+		s.cutoff = &kept
+	}
+	s.count = maxMessages
+	return nil
+}
+
+type cutoffIter struct {
+	iter   messageIter
+	cutoff *Message
+}
+
+func (it *cutoffIter) next() (*Message, error) {
+	for {
+		msg, err := it.iter.next()
+		if err != nil || msg == nil {
+			return msg, err
+		}
+		if !messageBefore(msg, it.cutoff) {
+			return msg, nil
+		}
+	}
+}
+
+type peekIter struct {
+	iter    messageIter
+	head    *Message
+	peeked  bool
+	peekErr error
+}
+
+func (p *peekIter) peek() (*Message, error) {
+	if !p.peeked {
+		p.head, p.peekErr = p.iter.next()
+		p.peeked = true
+	}
+	return p.head, p.peekErr
+}
+
+func (p *peekIter) next() (*Message, error) {
+	if p.peeked {
+		p.peeked = false
+		return p.head, p.peekErr
+	}
+	return p.iter.next()
+}
+
+// messageBefore orders messages by timestamp, then snowflake ID.
+func messageBefore(a, b *Message) bool {
+	if !a.Timestamp.Equal(b.Timestamp) {
+		return a.Timestamp.Before(b.Timestamp)
+	}
+	return snowflakeLess(a.ID, b.ID)
+}
+
+// forEachMessage calls fn for every message in an export in chronological
+// order per channel, passing the owning section (nil for single-channel
+// exports).
+func forEachMessage(export *Export, fn func(section *ChannelExport, msg *Message) error) error {
+	if len(export.Channels) == 0 {
+		return eachMessage(export.messages(), func(msg *Message) error { return fn(nil, msg) })
+	}
+	for i := range export.Channels {
+		section := &export.Channels[i]
+		if err := eachMessage(section.messages(), func(msg *Message) error { return fn(section, msg) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func eachMessage(src messageSource, fn func(*Message) error) error {
+	return drain(src.all(), fn)
+}
+
+func drain(it messageIter, fn func(*Message) error) error {
+	for {
+		msg, err := it.next()
+		if err != nil {
+			return err
+		}
+		if msg == nil {
+			return nil
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// messages returns the export's own messages, spooled or in memory.
+func (e *Export) messages() messageSource {
+	if e.source != nil {
+		return e.source
+	}
+	return sliceSource(e.Messages)
+}
+
+func (s *ChannelExport) messages() messageSource {
+	if s.source != nil {
+		return s.source
+	}
+	return sliceSource(s.Messages)
+}
+
+// annotatedSource applies fn to each message as it is read from src, so
+// details gathered after the scrape (downloaded attachments) reach every
+// writer without rewriting the spool.
+type annotatedSource struct {
+	src messageSource
+	fn  func(*Message)
+}
+
+func (s *annotatedSource) len() int { return s.src.len() }
+
+func (s *annotatedSource) all() messageIter {
+	return &annotatedIter{iter: s.src.all(), fn: s.fn}
+}
+
+func (s *annotatedSource) groups() []messageIter {
+	groups := s.src.groups()
+	for i, it := range groups {
+		groups[i] = &annotatedIter{iter: it, fn: s.fn}
+	}
+	return groups
+}
+
+type annotatedIter struct {
+	iter messageIter
+	fn   func(*Message)
+}
+
+func (it *annotatedIter) next() (*Message, error) {
+	msg, err := it.iter.next()
+	if msg != nil {
+		it.fn(msg)
+	}
+	return msg, err
+}
+
+// annotateExport routes every message in the export through fn.
+func annotateExport(export *Export, fn func(*Message)) {
+	if len(export.Channels) == 0 {
+		export.source = &annotatedSource{src: export.messages(), fn: fn}
+		return
+	}
+	for i := range export.Channels {
+		section := &export.Channels[i]
+		section.source = &annotatedSource{src: section.messages(), fn: fn}
+	}
+}
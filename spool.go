@@ -0,0 +1,267 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// spool is an append-only file holding scraped pages so a run's memory use
+// does not grow with the channel. ScrapeChannel appends each page's keepers
+// newest-first as one JSON array (a segment); readers walk the segments
+// backward to produce chronological order. One spool is shared by every
+// channel and thread in a run, each writing its own spoolStream.
+type spool struct {
+	mu         sync.Mutex
+	file       *os.File
+	path       string
+	size       int64
+	persistent bool
+}
+
+type spoolSegment struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// spoolStream is one channel's (or thread's) pages within a spool.
+type spoolStream struct {
+	spool    *spool
+	segments []spoolSegment
+	count    int
+}
+
+// newTempSpool creates a spool in the OS temp dir that close removes.
+func newTempSpool() (*spool, error) {
+	file, err := os.CreateTemp("", "ripcord-*.spool")
+	if err != nil {
+		return nil, err
+	}
+	return &spool{file: file, path: file.Name()}, nil
+}
+
+// openSpool opens (or creates) a spool at path that survives close, for
+// checkpointed scrapes. The file is truncated to size so pages appended after
+// the last checkpoint are discarded on resume.
+func openSpool(path string, size int64) (*spool, error) {
+	file, err := os.OpenFile(filepath.Clean(path), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(size); err != nil {
+		return nil, errors.Join(err, file.Close())
+	}
+	return &spool{file: file, path: path, size: size, persistent: true}, nil
+}
+
+// close releases the file and deletes it unless the spool is persistent.
+func (s *spool) close() error {
+	if s == nil {
+		return nil
+	}
+	err := s.file.Close()
+	if s.persistent {
+		return err
+	}
+	if rmErr := os.Remove(s.path); rmErr != nil && !errors.Is(rmErr, fs.ErrNotExist) {
+		err = errors.Join(err, rmErr)
+	}
+	return err
+}
+
+// remove deletes a persistent spool once its checkpoint is no longer needed.
+func (s *spool) remove() error {
+	if err := s.file.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *spool) newStream() *spoolStream {
+	return &spoolStream{spool: s}
+}
+
+// restoreStream rebuilds a stream from checkpointed segments.
+func (s *spool) restoreStream(segments []spoolSegment, count int) *spoolStream {
+	return &spoolStream{spool: s, segments: append([]spoolSegment(nil), segments...), count: count}
+}
+
+func (s *spool) write(data []byte) (spoolSegment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seg := spoolSegment{Offset: s.size, Length: int64(len(data))}
+	if _, err := s.file.WriteAt(data, s.size); err != nil {
+		return spoolSegment{}, err
+	}
+	s.size += seg.Length
+	return seg, nil
+}
+
+func (s *spool) read(seg spoolSegment) ([]Message, error) {
+	data := make([]byte, seg.Length)
+	if _, err := s.file.ReadAt(data, seg.Offset); err != nil {
+		return nil, fmt.Errorf("read spool: %w", err)
+	}
+	var messages []Message
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, fmt.Errorf("decode spool: %w", err)
+	}
+	return messages, nil
+}
+
+// append stores one page of messages, newest-first as collected.
+func (st *spoolStream) append(batch []Message) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	seg, err := st.spool.write(data)
+	if err != nil {
+		return err
+	}
+	st.segments = append(st.segments, seg)
+	st.count += len(batch)
+	return nil
+}
+
+// end is the spool offset just past this stream's last segment.
+func (st *spoolStream) end() int64 {
+	if len(st.segments) == 0 {
+		return 0
+	}
+	last := st.segments[len(st.segments)-1]
+	return last.Offset + last.Length
+}
+
+// messageIter yields messages one at a time; next returns nil at the end.
+type messageIter interface {
+	next() (*Message, error)
+}
+
+// streamReader replays a stream in chronological order, holding at most one
+// page in memory.
+type streamReader struct {
+	stream *spoolStream
+	seg    int
+	page   []Message
+	idx    int
+	decor  func(*Message)
+}
+
+func (st *spoolStream) reader(decor func(*Message)) *streamReader {
+	return &streamReader{stream: st, seg: len(st.segments), decor: decor}
+}
+
+func (r *streamReader) next() (*Message, error) {
+	for r.idx <= 0 {
+		if r.seg == 0 {
+			return nil, nil
+		}
+		r.seg--
+		page, err := r.stream.spool.read(r.stream.segments[r.seg])
+		if err != nil {
+			return nil, err
+		}
+		r.page = page
+		r.idx = len(page)
+	}
+	r.idx--
+	msg := &r.page[r.idx]
+	if r.decor != nil {
+		r.decor(msg)
+	}
+	return msg, nil
+}
+
+// sliceIter walks an in-memory slice, used for exports loaded from disk.
+type sliceIter struct {
+	messages []Message
+	idx      int
+}
+
+func (it *sliceIter) next() (*Message, error) {
+	if it.idx >= len(it.messages) {
+		return nil, nil
+	}
+	it.idx++
+	return &it.messages[it.idx-1], nil
+}
+
+// mergeIter interleaves several chronological iterators by timestamp, then
+// message ID.
+type mergeIter struct {
+	heads mergeHeap
+	init  []messageIter
+}
+
+func newMergeIter(iters []messageIter) *mergeIter {
+	return &mergeIter{init: iters}
+}
+
+func (m *mergeIter) next() (*Message, error) {
+	if m.init != nil {
+		for i, it := range m.init {
+			msg, err := it.next()
+			if err != nil {
+				return nil, err
+			}
+			if msg != nil {
+				m.heads = append(m.heads, mergeHead{msg: msg, iter: it, order: i})
+			}
+		}
+		heap.Init(&m.heads)
+		m.init = nil
+	}
+	if len(m.heads) == 0 {
+		return nil, nil
+	}
+
+	head := &m.heads[0]
+	msg := head.msg
+	nextMsg, err := head.iter.next()
+	if err != nil {
+		return nil, err
+	}
+	if nextMsg == nil {
+		heap.Pop(&m.heads)
+	} else {
+		head.msg = nextMsg
+		heap.Fix(&m.heads, 0)
+	}
+	return msg, nil
+}
+
+type mergeHead struct {
+	msg   *Message
+	iter  messageIter
+	order int
+}
+
+type mergeHeap []mergeHead
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if messageBefore(h[i].msg, h[j].msg) != messageBefore(h[j].msg, h[i].msg) {
+		return messageBefore(h[i].msg, h[j].msg)
+	}
+	return h[i].order < h[j].order
+}
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x any)   { *h = append(*h, x.(mergeHead)) }
+func (h *mergeHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+var spoolEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// spooledAt builds a message posted minute minutes after spoolEpoch.
+func spooledAt(id string, minute int) Message {
+	return Message{ID: id, Timestamp: spoolEpoch.Add(time.Duration(minute) * time.Minute)}
+}
+
+func collectIDs(t *testing.T, it messageIter) []string {
+	t.Helper()
+	var ids []string
+	if err := drain(it, func(msg *Message) error {
+		ids = append(ids, msg.ID)
+		return nil
+	}); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	return ids
+}
+
+func newTestSpool(t *testing.T) *spool {
+	t.Helper()
+	s, err := newTempSpool()
+	if err != nil {
+		t.Fatalf("newTempSpool: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := s.close(); err != nil {
+			t.Errorf("close spool: %v", err)
+		}
+	})
+	return s
+}
+
+func TestSpoolStreamReplaysChronologically(t *testing.T) {
+	s := newTestSpool(t)
+	st := s.newStream()
+	// Pages arrive newest-first, as ScrapeChannel collects them.
+	for _, page := range [][]Message{
+		{spooledAt("6", 6), spooledAt("5", 5), spooledAt("4", 4)},
+		{},
+		{spooledAt("3", 3), spooledAt("2", 2)},
+		{spooledAt("1", 1)},
+	} {
+		if err := st.append(page); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	if st.count != 6 || len(st.segments) != 3 {
+		t.Errorf("stream has %d messages in %d segments, want 6 in 3", st.count, len(st.segments))
+	}
+
+	got := collectIDs(t, st.reader(nil))
+	if want := []string{"1", "2", "3", "4", "5", "6"}; !slices.Equal(got, want) {
+		t.Errorf("reader yielded %v, want %v", got, want)
+	}
+}
+
+func TestSpoolStreamsShareOneFile(t *testing.T) {
+	s := newTestSpool(t)
+	a, b := s.newStream(), s.newStream()
+	for _, step := range []struct {
+		st   *spoolStream
+		page []Message
+	}{
+		{a, []Message{spooledAt("a2", 2), spooledAt("a1", 1)}},
+		{b, []Message{spooledAt("b2", 2)}},
+		{a, []Message{spooledAt("a0", 0)}},
+	} {
+		if err := step.st.append(step.page); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	if got, want := collectIDs(t, a.reader(nil)), []string{"a0", "a1", "a2"}; !slices.Equal(got, want) {
+		t.Errorf("stream a yielded %v, want %v", got, want)
+	}
+	if got, want := collectIDs(t, b.reader(nil)), []string{"b2"}; !slices.Equal(got, want) {
+		t.Errorf("stream b yielded %v, want %v", got, want)
+	}
+	if a.end() != s.size {
+		t.Errorf("stream a ends at %d, want the spool size %d", a.end(), s.size)
+	}
+}
+
+func TestMergeIterInterleaves(t *testing.T) {
+	first := &sliceIter{messages: []Message{spooledAt("10", 1), spooledAt("30", 3), spooledAt("50", 5)}}
+	second := &sliceIter{messages: []Message{spooledAt("20", 2), spooledAt("40", 3), spooledAt("60", 6)}}
+	empty := &sliceIter{}
+
+	got := collectIDs(t, newMergeIter([]messageIter{first, empty, second}))
+	// 30 and 40 share a timestamp and sort by snowflake.
+	if want := []string{"10", "20", "30", "40", "50", "60"}; !slices.Equal(got, want) {
+		t.Errorf("merge yielded %v, want %v", got, want)
+	}
+}
+
+func TestMergeIterKeepsInputOrderOnTies(t *testing.T) {
+	first := &sliceIter{messages: []Message{spooledAt("7", 1)}}
+	second := &sliceIter{messages: []Message{spooledAt("7", 1)}}
+	it := newMergeIter([]messageIter{first, second})
+
+	a, err := it.next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := it.next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != &first.messages[0] || b != &second.messages[0] {
+		t.Error("identical messages did not come out in input order")
+	}
+}
+
+func scrapedSource(t *testing.T) *spoolSource {
+	t.Helper()
+	s := newTestSpool(t)
+	own := s.newStream()
+	if err := own.append([]Message{spooledAt("5", 5), spooledAt("3", 3), spooledAt("1", 1)}); err != nil {
+		t.Fatal(err)
+	}
+	late, early := s.newStream(), s.newStream()
+	if err := late.append([]Message{spooledAt("6", 6), spooledAt("4", 4)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := early.append([]Message{spooledAt("2", 2)}); err != nil {
+		t.Fatal(err)
+	}
+	return &spoolSource{
+		own: own,
+		threads: []threadStream{
+			{stream: late, parentID: "100", name: "late"},
+			{stream: early, parentID: "100", name: "early"},
+		},
+	}
+}
+
+func TestSpoolSourceMergesThreads(t *testing.T) {
+	src := scrapedSource(t)
+	if err := src.limit(0); err != nil {
+		t.Fatal(err)
+	}
+	if src.len() != 6 {
+		t.Errorf("len = %d, want 6", src.len())
+	}
+
+	threads := map[string]string{}
+	if err := drain(src.all(), func(msg *Message) error {
+		if msg.ThreadName != "" {
+			threads[msg.ID] = msg.ParentChannelID + "/" + msg.ThreadName
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"2": "100/early", "4": "100/late", "6": "100/late"}
+	for id, thread := range want {
+		if threads[id] != thread {
+			t.Errorf("message %s decorated as %q, want %q", id, threads[id], thread)
+		}
+	}
+	if len(threads) != len(want) {
+		t.Errorf("decorated %d messages, want %d", len(threads), len(want))
+	}
+}
+
+func TestSpoolSourceLimitKeepsNewest(t *testing.T) {
+	src := scrapedSource(t)
+	if err := src.limit(3); err != nil {
+		t.Fatal(err)
+	}
+	if src.len() != 3 {
+		t.Errorf("len = %d, want 3", src.len())
+	}
+	if got, want := collectIDs(t, src.all()), []string{"4", "5", "6"}; !slices.Equal(got, want) {
+		t.Errorf("limited source yielded %v, want %v", got, want)
+	}
+
+	// The early thread falls entirely before the cutoff and drops out.
+	groups := src.groups()
+	if len(groups) != 2 {
+		t.Fatalf("groups = %d, want the channel and one thread", len(groups))
+	}
+	if got, want := collectIDs(t, groups[0]), []string{"5"}; !slices.Equal(got, want) {
+		t.Errorf("own group yielded %v, want %v", got, want)
+	}
+	if got, want := collectIDs(t, groups[1]), []string{"4", "6"}; !slices.Equal(got, want) {
+		t.Errorf("thread group yielded %v, want %v", got, want)
+	}
+}
+
+func TestSpoolSourceGroupsOrderThreadsByFirstMessage(t *testing.T) {
+	src := scrapedSource(t)
+	if err := src.limit(0); err != nil {
+		t.Fatal(err)
+	}
+	groups := src.groups()
+	var got [][]string
+	for _, g := range groups {
+		got = append(got, collectIDs(t, g))
+	}
+	want := [][]string{{"1", "3", "5"}, {"2"}, {"4", "6"}}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("groups = %v, want %v", got, want)
+	}
+}
+
+func TestSliceSourceGroupsMatchSpoolSource(t *testing.T) {
+	messages := []Message{spooledAt("1", 1), spooledAt("2", 2), spooledAt("3", 3), spooledAt("4", 4)}
+	messages[1].ChannelID, messages[1].ThreadName = "t1", "first"
+	messages[3].ChannelID, messages[3].ThreadName = "t1", "first"
+
+	var got [][]string
+	for _, g := range sliceSource(messages).groups() {
+		got = append(got, collectIDs(t, g))
+	}
+	if want := [][]string{{"1", "3"}, {"2", "4"}}; !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("groups = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite" // pure-Go driver; release builds run with CGO_ENABLED=0
+)
+
+// sqliteSchemaVersion is stored in PRAGMA user_version so later releases can
+// migrate archives written by this one.
+const sqliteSchemaVersion = 5
+
+// sqliteSchema creates the version 1 tables: messages normalized into their
+// own tables and an external-content FTS5 index over messages.content kept
+// in sync via triggers. Every statement is idempotent so opening an existing
+// archive is a no-op.
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS runs (
+		id             INTEGER PRIMARY KEY AUTOINCREMENT,
+		exported_at    TEXT NOT NULL,
+		guild_id       TEXT,
+		channel_id     TEXT,
+		message_count  INTEGER NOT NULL,
+		new_messages   INTEGER NOT NULL DEFAULT 0,
+		partial        INTEGER NOT NULL DEFAULT 0,
+		stopped_before TEXT,
+		filters        TEXT NOT NULL,
+		stats          TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS authors (
+		id           TEXT PRIMARY KEY,
+		username     TEXT NOT NULL,
+		display_name TEXT,
+		bot          INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS messages (
+		id                  TEXT PRIMARY KEY,
+		channel_id          TEXT NOT NULL,
+		parent_channel_id   TEXT,
+		thread_name         TEXT,
+		author_id           TEXT REFERENCES authors(id),
+		content             TEXT NOT NULL,
+		timestamp           TEXT NOT NULL,
+		edited_timestamp    TEXT,
+		type                INTEGER NOT NULL,
+		reply_to_message_id TEXT,
+		reply_to_author_id  TEXT,
+		embed_count         INTEGER NOT NULL DEFAULT 0,
+		run_id              INTEGER REFERENCES runs(id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS messages_channel_time ON messages(channel_id, timestamp)`,
+	`CREATE INDEX IF NOT EXISTS messages_author ON messages(author_id)`,
+	`CREATE TABLE IF NOT EXISTS attachments (
+		id           TEXT PRIMARY KEY,
+		message_id   TEXT NOT NULL REFERENCES messages(id),
+		filename     TEXT NOT NULL,
+		url          TEXT NOT NULL,
+		content_type TEXT,
+		size_bytes   INTEGER
+	)`,
+	`CREATE INDEX IF NOT EXISTS attachments_message ON attachments(message_id)`,
+	`CREATE TABLE IF NOT EXISTS reactions (
+		message_id TEXT NOT NULL REFERENCES messages(id),
+		emoji      TEXT NOT NULL,
+		count      INTEGER NOT NULL,
+		PRIMARY KEY (message_id, emoji)
+	)`,
+	`CREATE TABLE IF NOT EXISTS mentions (
+		message_id TEXT NOT NULL REFERENCES messages(id),
+		kind       TEXT NOT NULL CHECK (kind IN ('user', 'role')),
+		target_id  TEXT NOT NULL,
+		PRIMARY KEY (message_id, kind, target_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS mentions_target ON mentions(kind, target_id)`,
+	`CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+		content, content='messages', content_rowid='rowid'
+	)`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+		INSERT INTO messages_fts(rowid, content) VALUES (new.rowid, new.content);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE OF content ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+		INSERT INTO messages_fts(rowid, content) VALUES (new.rowid, new.content);
+	END`,
+}
+
+// sqliteMigrations bring an archive from one schema version to the next:
+// sqliteMigrations[0] upgrades version 1 to 2, and so on. A new archive
+// starts from the version 1 tables, so it runs every migration too.
+var sqliteMigrations = [][]string{
+	{
+		`ALTER TABLE attachments ADD COLUMN local_path TEXT`,
+		`ALTER TABLE attachments ADD COLUMN sha256 TEXT`,
+		`ALTER TABLE attachments ADD COLUMN downloaded_bytes INTEGER`,
+		`ALTER TABLE attachments ADD COLUMN download_error TEXT`,
+		`CREATE INDEX attachments_sha256 ON attachments(sha256)`,
+	},
+	{
+		`CREATE TABLE embeds (
+			message_id    TEXT NOT NULL REFERENCES messages(id),
+			position      INTEGER NOT NULL,
+			type          TEXT,
+			title         TEXT,
+			description   TEXT,
+			url           TEXT,
+			timestamp     TEXT,
+			color         INTEGER,
+			author_name   TEXT,
+			author_url    TEXT,
+			provider_name TEXT,
+			footer        TEXT,
+			image_url     TEXT,
+			thumbnail_url TEXT,
+			video_url     TEXT,
+			fields        TEXT,
+			PRIMARY KEY (message_id, position)
+		)`,
+	},
+	{
+		`ALTER TABLE authors ADD COLUMN webhook INTEGER NOT NULL DEFAULT 0`,
+	},
+	{
+		`CREATE TABLE indicators (
+			message_id TEXT NOT NULL REFERENCES messages(id),
+			type       TEXT NOT NULL,
+			value      TEXT NOT NULL,
+			defanged   INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (message_id, type, value)
+		)`,
+		`CREATE INDEX indicators_value ON indicators(type, value)`,
+	},
+}
+
+// sqliteStatements are the prepared inserts used while writing one run.
+type sqliteStatements struct {
+	author     *sql.Stmt
+	message    *sql.Stmt
+	attachment *sql.Stmt
+	embed      *sql.Stmt
+	reaction   *sql.Stmt
+	mention    *sql.Stmt
+	indicator  *sql.Stmt
+}
+
+// writeSQLite appends an export to the archive at path, creating it on first
+// use. Messages already in the archive are left untouched (their IDs are the
+// primary key), so overlapping runs never duplicate rows; each run is
+// recorded in runs with how many messages it actually added.
+func writeSQLite(path string, export *Export) (err error) {
+	db, err := sql.Open("sqlite", filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := db.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	ctx := context.Background()
+	if err := migrateSQLite(ctx, db); err != nil {
+		return fmt.Errorf("prepare archive: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := insertRun(ctx, tx, export); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	return tx.Commit()
+}
+
+func migrateSQLite(ctx context.Context, db *sql.DB) error {
+	var version int
+	if err := db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > sqliteSchemaVersion {
+		return fmt.Errorf("archive schema version %d is newer than this ripcord supports (%d)", version, sqliteSchemaVersion)
+	}
+	for _, stmt := range sqliteSchema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if version == sqliteSchemaVersion {
+		return nil
+	}
+
+	// The migrations and the version bump commit together, so a failed
+	// upgrade leaves the archive as it was.
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	from := max(version, 1)
+	for i, step := range sqliteMigrations[from-1:] {
+		for _, stmt := range step {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return errors.Join(fmt.Errorf("migrate to schema version %d: %w", from+i+1, err), tx.Rollback())
+			}
+		}
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", sqliteSchemaVersion)); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	return tx.Commit()
+}
+
+func insertRun(ctx context.Context, tx *sql.Tx, export *Export) error {
+	filters, err := json.Marshal(export.Filters)
+	if err != nil {
+		return err
+	}
+	stats, err := json.Marshal(export.Stats)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO runs
+		(exported_at, guild_id, channel_id, message_count, partial, stopped_before, filters, stats)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		export.ExportedAt.Format(time.RFC3339Nano), nullString(export.GuildID), nullString(export.ChannelID),
+		export.MessageCount, export.Partial, nullString(export.StoppedBefore), string(filters), string(stats))
+	if err != nil {
+		return err
+	}
+	runID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	stmts, err := prepareSQLite(ctx, tx)
+	if err != nil {
+		return err
+	}
+	defer stmts.close()
+
+	added := 0
+	err = forEachMessage(export, func(_ *ChannelExport, msg *Message) error {
+		inserted, err := stmts.insertMessage(ctx, msg, runID)
+		if inserted {
+			added++
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE runs SET new_messages = ? WHERE id = ?", added, runID)
+	return err
+}
+
+func prepareSQLite(ctx context.Context, tx *sql.Tx) (*sqliteStatements, error) {
+	s := &sqliteStatements{}
+	queries := []struct {
+		dst   **sql.Stmt
+		query string
+	}{
+		{&s.author, `INSERT INTO authors (id, username, display_name, bot, webhook) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET username = excluded.username,
+				display_name = excluded.display_name, bot = excluded.bot, webhook = excluded.webhook`},
+		{&s.message, `INSERT INTO messages (id, channel_id, parent_channel_id, thread_name, author_id, content,
+				timestamp, edited_timestamp, type, reply_to_message_id, reply_to_author_id, embed_count, run_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(id) DO NOTHING`},
+		{&s.attachment, `INSERT INTO attachments (id, message_id, filename, url, content_type, size_bytes,
+				local_path, sha256, downloaded_bytes, download_error)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT(id) DO NOTHING`},
+		{&s.embed, `INSERT INTO embeds (message_id, position, type, title, description, url, timestamp, color,
+				author_name, author_url, provider_name, footer, image_url, thumbnail_url, video_url, fields)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`},
+		{&s.reaction, `INSERT INTO reactions (message_id, emoji, count) VALUES (?, ?, ?)
+			ON CONFLICT(message_id, emoji) DO NOTHING`},
+		{&s.mention, `INSERT INTO mentions (message_id, kind, target_id) VALUES (?, ?, ?)
+			ON CONFLICT DO NOTHING`},
+		{&s.indicator, `INSERT INTO indicators (message_id, type, value, defanged) VALUES (?, ?, ?, ?)
+			ON CONFLICT DO NOTHING`},
+	}
+	for _, q := range queries {
+		stmt, err := tx.PrepareContext(ctx, q.query)
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		*q.dst = stmt
+	}
+	return s, nil
+}
+
+func (s *sqliteStatements) close() {
+	for _, stmt := range []*sql.Stmt{s.author, s.message, s.attachment, s.embed, s.reaction, s.mention, s.indicator} {
+		if stmt != nil {
+			_ = stmt.Close()
+		}
+	}
+}
+
+// insertMessage stores msg and its children, reporting whether the message
+// was new. Children of a message already archived are skipped with it.
+func (s *sqliteStatements) insertMessage(ctx context.Context, msg *Message, runID int64) (bool, error) {
+	author := &msg.Author
+	if author.ID != "" {
+		if _, err := s.author.ExecContext(ctx, author.ID, author.Username, nullString(author.DisplayName), author.Bot, author.Webhook); err != nil {
+			return false, err
+		}
+	}
+
+	var edited, replyID, replyAuthor any
+	if msg.EditedTimestamp != nil {
+		edited = msg.EditedTimestamp.Format(time.RFC3339Nano)
+	}
+	if msg.ReplyTo != nil {
+		replyID, replyAuthor = msg.ReplyTo.MessageID, nullString(msg.ReplyTo.AuthorID)
+	}
+	res, err := s.message.ExecContext(ctx, msg.ID, msg.ChannelID, nullString(msg.ParentChannelID), nullString(msg.ThreadName),
+		nullString(author.ID), msg.Content, msg.Timestamp.Format(time.RFC3339Nano), edited, msg.Type,
+		replyID, replyAuthor, msg.EmbedCount, runID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	for i := range msg.Attachments {
+		att := &msg.Attachments[i]
+		var downloaded any
+		if att.SHA256 != "" {
+			downloaded = att.DownloadedBytes
+		}
+		if _, err := s.attachment.ExecContext(ctx, att.ID, msg.ID, att.Filename, att.URL, nullString(att.ContentType), att.Size,
+			nullString(att.LocalPath), nullString(att.SHA256), downloaded, nullString(att.DownloadError)); err != nil {
+			return true, err
+		}
+	}
+	for i := range msg.Embeds {
+		if err := s.insertEmbed(ctx, msg.ID, i, &msg.Embeds[i]); err != nil {
+			return true, err
+		}
+	}
+	for i := range msg.Reactions {
+		if _, err := s.reaction.ExecContext(ctx, msg.ID, msg.Reactions[i].Emoji, msg.Reactions[i].Count); err != nil {
+			return true, err
+		}
+	}
+	for _, id := range msg.MentionUserIDs {
+		if _, err := s.mention.ExecContext(ctx, msg.ID, "user", id); err != nil {
+			return true, err
+		}
+	}
+	for _, id := range msg.MentionRoleIDs {
+		if _, err := s.mention.ExecContext(ctx, msg.ID, "role", id); err != nil {
+			return true, err
+		}
+	}
+	for _, ind := range msg.Indicators {
+		if _, err := s.indicator.ExecContext(ctx, msg.ID, ind.Type, ind.Value, ind.Defanged); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// insertEmbed stores one embed; its fields are kept as a JSON array, which
+// SQLite's json_each can unpack.
+func (s *sqliteStatements) insertEmbed(ctx context.Context, messageID string, position int, embed *Embed) error {
+	var fields, color any
+	if len(embed.Fields) > 0 {
+		data, err := json.Marshal(embed.Fields)
+		if err != nil {
+			return err
+		}
+		fields = string(data)
+	}
+	if embed.Color != 0 {
+		color = embed.Color
+	}
+	_, err := s.embed.ExecContext(ctx, messageID, position, nullString(embed.Type), nullString(embed.Title),
+		nullString(embed.Description), nullString(embed.URL), nullString(embed.Timestamp), color,
+		nullString(embed.AuthorName), nullString(embed.AuthorURL), nullString(embed.ProviderName),
+		nullString(embed.Footer), nullString(embed.ImageURL), nullString(embed.ThumbnailURL),
+		nullString(embed.VideoURL), fields)
+	return err
+}
+
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
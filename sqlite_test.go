@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// createArchive writes an archive at an older schema version holding one
+// message, as the release that introduced that version would have.
+func createArchive(t *testing.T, path string, version int) {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	stmts := append([]string{}, sqliteSchema...)
+	for _, step := range sqliteMigrations[:version-1] {
+		stmts = append(stmts, step...)
+	}
+	stmts = append(stmts,
+		`INSERT INTO messages (id, channel_id, content, timestamp, type) VALUES ('0', '100', 'old', '2025-01-01T00:00:00Z', 0)`,
+		`INSERT INTO attachments (id, message_id, filename, url) VALUES ('a0', '0', 'old.txt', 'https://cdn.example/old.txt')`,
+		fmt.Sprintf(`PRAGMA user_version = %d`, version),
+	)
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+}
+
+func openRawArchive(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// openArchive opens an archive ripcord wrote and checks it is at the
+// current schema version.
+func openArchive(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db := openRawArchive(t, path)
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != sqliteSchemaVersion {
+		t.Fatalf("user_version = %d, want %d", version, sqliteSchemaVersion)
+	}
+	return db
+}
+
+func queryRow(t *testing.T, db *sql.DB, query string, dest ...any) {
+	t.Helper()
+	if err := db.QueryRow(query).Scan(dest...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+func TestWriteSQLiteAttachments(t *testing.T) {
+	export := &Export{
+		ChannelID:    "100",
+		ExportedAt:   time.Date(2025, 3, 12, 8, 30, 0, 0, time.UTC),
+		MessageCount: 1,
+		Messages: []Message{{
+			ID:        "1",
+			ChannelID: "100",
+			Content:   "sample attached",
+			Author:    Author{ID: "42", Username: "alice"},
+			Timestamp: time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC),
+			Attachments: []Attachment{
+				{ID: "a1", Filename: "drop.bin", URL: "https://cdn.example/drop.bin", Size: 4,
+					LocalPath: "out_files/1/drop.bin", SHA256: "88d4266fd4e6338d13b845fcf289579d209c897823b9217da3e161936f031589", DownloadedBytes: 4},
+				{ID: "a2", Filename: "big.iso", URL: "https://cdn.example/big.iso", Size: 1 << 30,
+					DownloadError: "larger than --max-attachment-mb"},
+			},
+		}},
+	}
+	for _, existing := range []bool{false, true} {
+		t.Run(fmt.Sprintf("existing v1 archive %v", existing), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "archive.sqlite")
+			if existing {
+				createArchive(t, path, 1)
+			}
+			if err := writeSQLite(path, export); err != nil {
+				t.Fatalf("writeSQLite: %v", err)
+			}
+			db := openArchive(t, path)
+
+			var localPath, sum sql.NullString
+			var downloaded sql.NullInt64
+			queryRow(t, db, `SELECT local_path, sha256, downloaded_bytes FROM attachments WHERE id = 'a1'`, &localPath, &sum, &downloaded)
+			if localPath.String != "out_files/1/drop.bin" || sum.String == "" || downloaded.Int64 != 4 {
+				t.Errorf("downloaded attachment stored as %v %v %v", localPath, sum, downloaded)
+			}
+			var downloadErr sql.NullString
+			queryRow(t, db, `SELECT download_error, sha256 FROM attachments WHERE id = 'a2'`, &downloadErr, &sum)
+			if downloadErr.String == "" || sum.Valid {
+				t.Errorf("failed attachment stored as %v %v", downloadErr, sum)
+			}
+			if existing {
+				var count int
+				queryRow(t, db, `SELECT count(*) FROM attachments WHERE id = 'a0' AND local_path IS NULL`, &count)
+				if count != 1 {
+					t.Error("attachment archived before the migration was lost")
+				}
+			}
+		})
+	}
+}
+
+func TestWriteSQLiteEmbeds(t *testing.T) {
+	export := &Export{
+		ChannelID:    "100",
+		ExportedAt:   time.Date(2025, 3, 12, 8, 30, 0, 0, time.UTC),
+		MessageCount: 1,
+		Messages: []Message{{
+			ID:         "1",
+			ChannelID:  "100",
+			Content:    "",
+			Author:     Author{ID: "42", Username: "alertbot"},
+			Timestamp:  time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC),
+			EmbedCount: 2,
+			Embeds: []Embed{
+				{Type: "link", URL: "https://evil.example/", Title: "Evil"},
+				{Type: "rich", Title: "Alert", Color: 0xff0000, Fields: []EmbedField{
+					{Name: "Host", Value: "203.0.113.9", Inline: true},
+					{Name: "Hash", Value: "9f86d081"},
+				}},
+			},
+		}},
+	}
+	path := filepath.Join(t.TempDir(), "archive.sqlite")
+	if err := writeSQLite(path, export); err != nil {
+		t.Fatalf("writeSQLite: %v", err)
+	}
+	db := openArchive(t, path)
+
+	var count int
+	queryRow(t, db, `SELECT count(*) FROM embeds WHERE message_id = '1'`, &count)
+	if count != 2 {
+		t.Fatalf("%d embeds archived, want 2", count)
+	}
+	var title string
+	var color sql.NullInt64
+	queryRow(t, db, `SELECT title, color FROM embeds WHERE message_id = '1' AND position = 1`, &title, &color)
+	if title != "Alert" || color.Int64 != 0xff0000 {
+		t.Errorf("second embed stored as %q color %v", title, color)
+	}
+	var value string
+	queryRow(t, db, `SELECT f.value ->> 'value' FROM embeds e, json_each(e.fields) f
+		WHERE e.message_id = '1' AND f.value ->> 'name' = 'Host'`, &value)
+	if value != "203.0.113.9" {
+		t.Errorf("embed field Host = %q", value)
+	}
+}
+
+func TestWriteSQLiteAuthors(t *testing.T) {
+	export := &Export{
+		ChannelID:    "100",
+		ExportedAt:   time.Date(2025, 3, 12, 8, 30, 0, 0, time.UTC),
+		MessageCount: 3,
+		Messages: []Message{{
+			ID:        "1",
+			ChannelID: "100",
+			Content:   "looks good",
+			Author:    Author{ID: "42", Username: "alice"},
+			Timestamp: time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC),
+		}, {
+			ID:        "2",
+			ChannelID: "100",
+			Content:   "deploy finished",
+			Author:    Author{ID: "77", Username: "ci", Webhook: true},
+			Timestamp: time.Date(2025, 3, 10, 12, 5, 0, 0, time.UTC),
+		}, {
+			ID:        "3",
+			ChannelID: "100",
+			Content:   "Now playing",
+			Author:    Author{ID: "88", Username: "music", Bot: true},
+			Timestamp: time.Date(2025, 3, 10, 12, 6, 0, 0, time.UTC),
+		}},
+	}
+	path := filepath.Join(t.TempDir(), "archive.sqlite")
+	createArchive(t, path, 3)
+	if err := writeSQLite(path, export); err != nil {
+		t.Fatalf("writeSQLite: %v", err)
+	}
+	db := openArchive(t, path)
+
+	for id, want := range map[string][2]bool{"42": {false, false}, "77": {false, true}, "88": {true, false}} {
+		var bot, webhook bool
+		queryRow(t, db, `SELECT bot, webhook FROM authors WHERE id = '`+id+`'`, &bot, &webhook)
+		if bot != want[0] || webhook != want[1] {
+			t.Errorf("author %s: bot %v webhook %v, want %v %v", id, bot, webhook, want[0], want[1])
+		}
+	}
+}
+
+func TestWriteSQLiteIndicators(t *testing.T) {
+	export := &Export{
+		ChannelID:    "100",
+		ExportedAt:   time.Date(2025, 3, 12, 8, 30, 0, 0, time.UTC),
+		MessageCount: 1,
+		Messages: []Message{{
+			ID:        "1",
+			ChannelID: "100",
+			Content:   "payload at https://evil.example/drop.bin, also served from evil[.]example",
+			Author:    Author{ID: "42", Username: "alice"},
+			Timestamp: time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC),
+			Indicators: []Indicator{
+				{Type: indicatorURL, Value: "https://evil.example/drop.bin"},
+				{Type: indicatorDomain, Value: "evil.example", Defanged: true},
+			},
+		}},
+	}
+	path := filepath.Join(t.TempDir(), "archive.sqlite")
+	if err := writeSQLite(path, export); err != nil {
+		t.Fatalf("writeSQLite: %v", err)
+	}
+	db := openArchive(t, path)
+
+	var messageID string
+	var defanged bool
+	queryRow(t, db, `SELECT message_id, defanged FROM indicators WHERE type = 'domain' AND value = 'evil.example'`, &messageID, &defanged)
+	if messageID != "1" || !defanged {
+		t.Errorf("domain indicator stored as message %s defanged %v", messageID, defanged)
+	}
+	var count int
+	queryRow(t, db, `SELECT count(*) FROM indicators`, &count)
+	if count != 2 {
+		t.Errorf("%d indicators archived, want 2", count)
+	}
+}
+
+func TestMigrateSQLiteFromEachVersion(t *testing.T) {
+	for version := 1; version < sqliteSchemaVersion; version++ {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "archive.sqlite")
+			createArchive(t, path, version)
+			db := openRawArchive(t, path)
+			if err := migrateSQLite(context.Background(), db); err != nil {
+				t.Fatalf("migrateSQLite: %v", err)
+			}
+			var got, count int
+			queryRow(t, db, "PRAGMA user_version", &got)
+			if got != sqliteSchemaVersion {
+				t.Errorf("user_version = %d, want %d", got, sqliteSchemaVersion)
+			}
+			queryRow(t, db, `SELECT count(*) FROM messages WHERE id = '0'`, &count)
+			if count != 1 {
+				t.Error("message archived before the migration was lost")
+			}
+		})
+	}
+}
+
+func TestMigrateSQLiteRejectsNewerArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.sqlite")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", sqliteSchemaVersion+1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateSQLite(context.Background(), db); err == nil {
+		t.Error("migrateSQLite accepted an archive from a newer release")
+	}
+}
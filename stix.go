@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// STIX 2.1 objects written by --format stix. Every ID is a UUIDv5 derived
+// from what the object describes, so re-exporting the same messages yields
+// the same IDs and a TIP can de-duplicate across runs.
+type stixCommon struct {
+	Type         string `json:"type"`
+	SpecVersion  string `json:"spec_version"`
+	ID           string `json:"id"`
+	Created      string `json:"created"`
+	Modified     string `json:"modified"`
+	CreatedByRef string `json:"created_by_ref,omitempty"`
+}
+
+type stixExternalRef struct {
+	SourceName string `json:"source_name"`
+	ExternalID string `json:"external_id,omitempty"`
+	URL        string `json:"url,omitempty"`
+}
+
+type stixIdentity struct {
+	stixCommon
+	Name          string `json:"name"`
+	IdentityClass string `json:"identity_class"`
+	Description   string `json:"description,omitempty"`
+	DiscordUserID string `json:"x_discord_user_id,omitempty"`
+}
+
+type stixNote struct {
+	stixCommon
+	Abstract         string   `json:"abstract,omitempty"`
+	Content          string   `json:"content"`
+	Authors          []string `json:"authors,omitempty"`
+	ObjectRefs       []string `json:"object_refs"`
+	DiscordMessageID string   `json:"x_discord_message_id"`
+	DiscordChannelID string   `json:"x_discord_channel_id"`
+	DiscordThread    string   `json:"x_discord_thread_name,omitempty"`
+}
+
+type stixIndicator struct {
+	stixCommon
+	Name           string   `json:"name"`
+	Description    string   `json:"description,omitempty"`
+	IndicatorTypes []string `json:"indicator_types"`
+	Pattern        string   `json:"pattern"`
+	PatternType    string   `json:"pattern_type"`
+	ValidFrom      string   `json:"valid_from"`
+}
+
+type stixVulnerability struct {
+	stixCommon
+	Name               string            `json:"name"`
+	ExternalReferences []stixExternalRef `json:"external_references"`
+}
+
+type stixReport struct {
+	stixCommon
+	Name             string        `json:"name"`
+	Description      string        `json:"description"`
+	ReportTypes      []string      `json:"report_types"`
+	Published        string        `json:"published"`
+	ObjectRefs       []string      `json:"object_refs"`
+	Filters          FilterSummary `json:"x_ripcord_filters"`
+	DiscordGuildID   string        `json:"x_discord_guild_id,omitempty"`
+	DiscordChannelID string        `json:"x_discord_channel_id,omitempty"`
+}
+
+const (
+	stixSpecVersion = "2.1"
+	stixExtension   = ".stix.json"
+
+	// stixEpoch stamps the tool and author identities. They describe the
+	// same thing in every run, so they must not take the export time: a TIP
+	// would see each re-export as a new version of them.
+	stixEpoch = "1970-01-01T00:00:00.000Z"
+)
+
+// uuidNamespace seeds every UUIDv5 ripcord generates for STIX and MISP IDs.
+var uuidNamespace = [16]byte{0x5b, 0x1e, 0x0c, 0x3a, 0x8d, 0x2f, 0x4e, 0x61, 0x9a, 0x57, 0x0e, 0x6c, 0x2b, 0x94, 0xd1, 0x7f}
+
+// stixPatterns maps indicator types to STIX pattern object paths. Crypto
+// wallet addresses have no STIX 2.1 cyber-observable, so they are left out
+// of the bundle; CVE IDs become vulnerability objects instead.
+var stixPatterns = map[string]string{
+	indicatorURL:    "url:value",
+	indicatorDomain: "domain-name:value",
+	indicatorIPv4:   "ipv4-addr:value",
+	indicatorIPv6:   "ipv6-addr:value",
+	indicatorEmail:  "email-addr:value",
+	indicatorMD5:    "file:hashes.MD5",
+	indicatorSHA1:   "file:hashes.'SHA-1'",
+	indicatorSHA256: "file:hashes.'SHA-256'",
+	indicatorSHA512: "file:hashes.'SHA-512'",
+}
+
+// writeSTIX writes the export as a STIX 2.1 bundle: a ripcord identity, a
+// note per message (created_by_ref its author's identity), one identity per
+// author, an indicator per extracted observable, a vulnerability per CVE,
+// and a report tying the notes to the channel and filters. Notes are
+// streamed as they are read; everything else follows once all messages have
+// been seen.
+func writeSTIX(path string, export *Export) (err error) {
+	if export.Indicators == nil {
+		if err := summarizeIndicators(export); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := file.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	w := bufio.NewWriter(file)
+	sw := &stixWriter{w: w, created: stixTime(export.ExportedAt), authors: make(map[string]*Author)}
+	sw.tool = stixID("identity", "ripcord")
+	scope := export.GuildID + "/" + export.ChannelID + "/" + sw.created
+	fmt.Fprintf(w, "{\n  \"type\": \"bundle\",\n  \"id\": %q,\n  \"objects\": [", stixID("bundle", scope))
+
+	if err := sw.object(stixIdentity{
+		stixCommon:    sw.common("identity", sw.tool, stixEpoch),
+		Name:          "ripcord",
+		IdentityClass: "system",
+		Description:   "Discord channel exporter",
+	}); err != nil {
+		return err
+	}
+	err = forEachMessage(export, func(_ *ChannelExport, msg *Message) error {
+		return sw.note(msg)
+	})
+	if err != nil {
+		return err
+	}
+	if err := sw.identities(); err != nil {
+		return err
+	}
+	if err := sw.indicators(export.Indicators); err != nil {
+		return err
+	}
+	if err := sw.object(sw.report(export, scope)); err != nil {
+		return err
+	}
+	if _, err := w.WriteString("\n  ]\n}\n"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+type stixWriter struct {
+	w        *bufio.Writer
+	created  string
+	tool     string
+	count    int
+	authors  map[string]*Author
+	order    []string
+	notes    []string
+	observed []string
+}
+
+func (sw *stixWriter) common(kind, id, created string) stixCommon {
+	return stixCommon{Type: kind, SpecVersion: stixSpecVersion, ID: id, Created: created, Modified: created}
+}
+
+// object appends one object to the bundle's objects array.
+func (sw *stixWriter) object(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	sep := ",\n    "
+	if sw.count == 0 {
+		sep = "\n    "
+	}
+	sw.count++
+	if _, err := sw.w.WriteString(sep); err != nil {
+		return err
+	}
+	_, err = sw.w.Write(data)
+	return err
+}
+
+func (sw *stixWriter) note(msg *Message) error {
+	author := sw.authorID(&msg.Author)
+	refs := []string{author}
+	for _, ind := range msg.Indicators {
+		if id := stixObservableID(ind.Type, ind.Value); id != "" {
+			refs = append(refs, id)
+		}
+	}
+	created := stixTime(msg.Timestamp)
+	note := stixNote{
+		stixCommon:       sw.common("note", stixID("note", msg.ID), created),
+		Content:          messageText(msg),
+		Authors:          []string{describeAuthor(&msg.Author)},
+		ObjectRefs:       refs,
+		DiscordMessageID: msg.ID,
+		DiscordChannelID: msg.ChannelID,
+		DiscordThread:    msg.ThreadName,
+	}
+	note.CreatedByRef = author
+	if msg.EditedTimestamp != nil {
+		note.Modified = stixTime(*msg.EditedTimestamp)
+	}
+	if note.Content == "" {
+		note.Abstract = fmt.Sprintf("%s message with no text", messageTypeName(msg.Type))
+	}
+	sw.notes = append(sw.notes, note.ID)
+	return sw.object(note)
+}
+
+// authorID returns the identity ID for an author, remembering the author so
+// identities() can write it after the notes.
+func (sw *stixWriter) authorID(author *Author) string {
+	key := author.ID
+	if key == "" {
+		key = "username:" + author.Username
+	}
+	if _, ok := sw.authors[key]; !ok {
+		copied := *author
+		sw.authors[key] = &copied
+		sw.order = append(sw.order, key)
+	}
+	return stixID("identity", "discord-user:"+key)
+}
+
+func (sw *stixWriter) identities() error {
+	for _, key := range sw.order {
+		author := sw.authors[key]
+		class := "individual"
+		if author.Bot || author.Webhook {
+			class = "system"
+		}
+		err := sw.object(stixIdentity{
+			stixCommon:    sw.common("identity", stixID("identity", "discord-user:"+key), stixEpoch),
+			Name:          describeAuthor(author),
+			IdentityClass: class,
+			DiscordUserID: author.ID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sw *stixWriter) indicators(summaries []IndicatorSummary) error {
+	for i := range summaries {
+		s := &summaries[i]
+		id := stixObservableID(s.Type, s.Value)
+		if id == "" {
+			continue
+		}
+		sw.observed = append(sw.observed, id)
+		description := fmt.Sprintf("Seen %s in Discord, first in message %s at %s, last in message %s at %s.",
+			seenTimes(s.Count), s.FirstSeenID, s.FirstSeenAt.UTC().Format(time.RFC3339), s.LastSeenID, s.LastSeenAt.UTC().Format(time.RFC3339))
+		// Created and modified follow the messages rather than the export,
+		// so re-exporting the same messages yields the same object.
+		common := sw.common("", id, stixTime(s.FirstSeenAt))
+		common.Modified = stixTime(s.LastSeenAt)
+		common.CreatedByRef = sw.tool
+
+		var obj any
+		if s.Type == indicatorCVE {
+			common.Type = "vulnerability"
+			obj = stixVulnerability{
+				stixCommon:         common,
+				Name:               s.Value,
+				ExternalReferences: []stixExternalRef{{SourceName: "cve", ExternalID: s.Value}},
+			}
+		} else {
+			common.Type = "indicator"
+			obj = stixIndicator{
+				stixCommon:     common,
+				Name:           s.Type + ": " + s.Value,
+				Description:    description,
+				IndicatorTypes: []string{"unknown"},
+				Pattern:        fmt.Sprintf("[%s = '%s']", stixPatterns[s.Type], stixEscape(s.Value)),
+				PatternType:    "stix",
+				ValidFrom:      stixTime(s.FirstSeenAt),
+			}
+		}
+		if err := sw.object(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sw *stixWriter) report(export *Export, scope string) stixReport {
+	name := "Discord export for multiple channels"
+	switch {
+	case export.ChannelID != "":
+		name = "Discord export for channel " + export.ChannelID
+	case export.GuildID != "":
+		name = "Discord export for guild " + export.GuildID
+	}
+	refs := append(append([]string{}, sw.notes...), sw.observed...)
+	if len(refs) == 0 {
+		// object_refs must not be empty; an export with no messages still
+		// names the tool that produced it.
+		refs = []string{sw.tool}
+	}
+	common := sw.common("report", stixID("report", scope), sw.created)
+	common.CreatedByRef = sw.tool
+	return stixReport{
+		stixCommon:       common,
+		Name:             name,
+		Description:      stixReportDescription(export),
+		ReportTypes:      []string{"threat-report"},
+		Published:        sw.created,
+		ObjectRefs:       refs,
+		Filters:          export.Filters,
+		DiscordGuildID:   export.GuildID,
+		DiscordChannelID: export.ChannelID,
+	}
+}
+
+func stixReportDescription(export *Export) string {
+	parts := []string{fmt.Sprintf("%d messages", export.MessageCount)}
+	if f := export.Filters; f.Since != nil || f.Until != nil {
+		window := "from "
+		if f.Since != nil {
+			window += f.Since.UTC().Format(time.RFC3339)
+		} else {
+			window += "the beginning"
+		}
+		if f.Until != nil {
+			window += " to " + f.Until.UTC().Format(time.RFC3339)
+		}
+		parts = append(parts, window)
+	}
+	if len(export.Filters.Keywords) > 0 {
+		parts = append(parts, "keywords: "+strings.Join(export.Filters.Keywords, ", "))
+	}
+	if export.Filters.Query != "" {
+		parts = append(parts, "query: "+export.Filters.Query)
+	}
+	if export.Partial {
+		parts = append(parts, "partial export"+stoppedSuffix(export.StoppedBefore))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// stixObservableID is the indicator (or vulnerability) ID for an extracted
+// value, or "" for types STIX has no pattern for.
+func stixObservableID(kind, value string) string {
+	if kind == indicatorCVE {
+		return stixID("vulnerability", value)
+	}
+	if _, ok := stixPatterns[kind]; !ok {
+		return ""
+	}
+	return stixID("indicator", kind+":"+value)
+}
+
+// stixID builds "<type>--<uuidv5(type:name)>".
+func stixID(kind, name string) string {
+	return kind + "--" + uuid5(kind+":"+name)
+}
+
+// uuid5 derives a version 5 UUID for name, so the same input always maps to
+// the same ID.
+func uuid5(name string) string {
+	h := sha1.New() // UUIDv5 is defined over SHA-1
+	h.Write(uuidNamespace[:])
+	h.Write([]byte(name))
+	sum := h.Sum(nil)
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// seenTimes spells out an indicator's count for descriptions: "once",
+// "2 times".
+func seenTimes(count int) string {
+	if count == 1 {
+		return "once"
+	}
+	return fmt.Sprintf("%d times", count)
+}
+
+// stixTime formats t the way STIX timestamps require: UTC with a Z suffix
+// and millisecond precision.
+func stixTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// stixEscape escapes a value for use inside a single-quoted pattern string.
+func stixEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stixTestExport has a URL posted twice, a CVE, and a bot's edited message
+// carrying a hash and an IP address.
+func stixTestExport() *Export {
+	first := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	edited := first.Add(time.Hour)
+	return &Export{
+		ChannelID:    "100",
+		ExportedAt:   time.Date(2025, 3, 12, 8, 30, 0, 0, time.UTC),
+		MessageCount: 3,
+		Messages: []Message{
+			{
+				ID:        "1",
+				ChannelID: "100",
+				Content:   "payload at https://evil.example/drop.bin, see CVE-2024-3400",
+				Author:    Author{ID: "42", Username: "alice"},
+				Timestamp: first,
+			},
+			{
+				ID:              "2",
+				ChannelID:       "100",
+				Content:         "hash 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08 from 203.0.113.9",
+				Author:          Author{ID: "43", Username: "relay", Bot: true},
+				Timestamp:       first.Add(time.Minute),
+				EditedTimestamp: &edited,
+			},
+			{
+				ID:        "3",
+				ChannelID: "100",
+				Content:   "again https://evil.example/drop.bin",
+				Author:    Author{ID: "42", Username: "alice"},
+				Timestamp: first.Add(2 * time.Minute),
+			},
+		},
+	}
+}
+
+// readSTIX writes export as a bundle and decodes it as generic objects.
+func readSTIX(t *testing.T, export *Export) []map[string]any {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "out"+stixExtension)
+	if err := writeSTIX(path, export); err != nil {
+		t.Fatalf("writeSTIX: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bundle struct {
+		Type    string           `json:"type"`
+		ID      string           `json:"id"`
+		Objects []map[string]any `json:"objects"`
+	}
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		t.Fatalf("bundle is not valid JSON: %v", err)
+	}
+	if bundle.Type != "bundle" || !stixIDPattern.MatchString(bundle.ID) {
+		t.Fatalf("bundle type %q id %q", bundle.Type, bundle.ID)
+	}
+	return bundle.Objects
+}
+
+var (
+	stixIDPattern   = regexp.MustCompile(`^[a-z][a-z0-9-]*--[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	stixTimePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}Z$`)
+)
+
+func TestWriteSTIXBundle(t *testing.T) {
+	objects := readSTIX(t, stixTestExport())
+
+	ids := make(map[string]map[string]any)
+	kinds := make(map[string]int)
+	for _, obj := range objects {
+		kind, _ := obj["type"].(string)
+		id, _ := obj["id"].(string)
+		if kind == "" {
+			t.Errorf("object without type: %v", obj)
+			continue
+		}
+		kinds[kind]++
+		if obj["spec_version"] != stixSpecVersion {
+			t.Errorf("%s: spec_version %v", id, obj["spec_version"])
+		}
+		if !stixIDPattern.MatchString(id) || id[:len(kind)+2] != kind+"--" {
+			t.Errorf("%s: id does not have the form %s--<uuid>", id, kind)
+		}
+		if _, dup := ids[id]; dup {
+			t.Errorf("%s: duplicate id", id)
+		}
+		ids[id] = obj
+		for _, field := range []string{"created", "modified"} {
+			value, _ := obj[field].(string)
+			if !stixTimePattern.MatchString(value) {
+				t.Errorf("%s: %s %q is not an RFC 3339 timestamp with milliseconds", id, field, value)
+			}
+		}
+		if obj["modified"].(string) < obj["created"].(string) {
+			t.Errorf("%s: modified %v before created %v", id, obj["modified"], obj["created"])
+		}
+		if kind == "indicator" {
+			if obj["pattern"] == "" || obj["pattern"] == nil || obj["pattern_type"] != "stix" {
+				t.Errorf("%s: pattern %v pattern_type %v", id, obj["pattern"], obj["pattern_type"])
+			}
+		}
+	}
+
+	for kind, want := range map[string]int{"note": 3, "identity": 3, "indicator": 4, "vulnerability": 1, "report": 1} {
+		if kinds[kind] != want {
+			t.Errorf("%d %s objects, want %d", kinds[kind], kind, want)
+		}
+	}
+
+	for id, obj := range ids {
+		if ref, ok := obj["created_by_ref"].(string); ok && ids[ref] == nil {
+			t.Errorf("%s: created_by_ref %s is not in the bundle", id, ref)
+		}
+		refs, ok := obj["object_refs"]
+		if !ok {
+			continue
+		}
+		list, _ := refs.([]any)
+		if len(list) == 0 {
+			t.Errorf("%s: empty object_refs", id)
+		}
+		for _, ref := range list {
+			if ids[ref.(string)] == nil {
+				t.Errorf("%s: object_refs entry %v is not in the bundle", id, ref)
+			}
+		}
+	}
+}
+
+func TestWriteSTIXStableAcrossExports(t *testing.T) {
+	export := stixTestExport()
+	first := readSTIX(t, export)
+	export = stixTestExport()
+	export.ExportedAt = export.ExportedAt.Add(24 * time.Hour)
+	second := readSTIX(t, export)
+
+	byID := make(map[string]map[string]any)
+	for _, obj := range first {
+		byID[obj["id"].(string)] = obj
+	}
+	for _, obj := range second {
+		if obj["type"] == "report" {
+			continue
+		}
+		id := obj["id"].(string)
+		prev := byID[id]
+		if prev == nil {
+			t.Errorf("%s: not in the earlier export", id)
+			continue
+		}
+		if prev["created"] != obj["created"] || prev["modified"] != obj["modified"] {
+			t.Errorf("%s: created/modified changed from %v/%v to %v/%v",
+				id, prev["created"], prev["modified"], obj["created"], obj["modified"])
+		}
+	}
+
+	found := false
+	for _, obj := range first {
+		if obj["type"] == "indicator" && obj["name"] == "url: https://evil.example/drop.bin" {
+			found = true
+			if obj["created"] != "2025-03-10T12:00:00.000Z" || obj["modified"] != "2025-03-10T12:02:00.000Z" {
+				t.Errorf("url indicator dated %v/%v, want first and last seen", obj["created"], obj["modified"])
+			}
+			if desc, _ := obj["description"].(string); !strings.HasPrefix(desc, "Seen 2 times in Discord, first in message 1 ") {
+				t.Errorf("url indicator description %q", desc)
+			}
+		}
+		if obj["type"] == "indicator" && obj["name"] == "ipv4: 203.0.113.9" {
+			if desc, _ := obj["description"].(string); !strings.HasPrefix(desc, "Seen once in Discord, first in message 2 ") {
+				t.Errorf("ipv4 indicator description %q", desc)
+			}
+		}
+	}
+	if !found {
+		t.Error("no indicator for the repeated URL")
+	}
+}
+
+func TestWriteSTIXEmptyExport(t *testing.T) {
+	objects := readSTIX(t, &Export{ChannelID: "100", ExportedAt: time.Now()})
+	report := objects[len(objects)-1]
+	if report["type"] != "report" {
+		t.Fatalf("last object is %v, want the report", report["type"])
+	}
+	if refs, _ := report["object_refs"].([]any); len(refs) == 0 {
+		t.Error("report of an empty export has no object_refs")
+	}
+}
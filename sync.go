@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// runSync implements `ripcord sync <export.json>`: it fetches messages newer
+// than the archive's newest one and merges them in place (or into --output).
+func runSync(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	token := flags.String("token", "", "Discord bot/user token (or set DISCORD_TOKEN)")
+	output := flags.String("output", "", "Write the merged archive here instead of updating in place")
+	sign := flags.Bool("sign", false, "Sign the updated archive with the key from `ripcord keygen`")
+	quiet := flags.Bool("quiet", false, "Only print errors")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: ripcord sync [--token <t>] [--output <file>] [--sign] <export.json>")
+	}
+
+	resolvedToken := resolveToken(*token)
+	if resolvedToken == "" {
+		return errors.New("missing Discord token (pass --token, set DISCORD_TOKEN, or run `ripcord set-token`)")
+	}
+
+	signingKey, err := resolveSigningKey(*sign, *output)
+	if err != nil {
+		return err
+	}
+
+	path := flags.Arg(0)
+	export, err := loadExport(path)
+	if err != nil {
+		return fmt.Errorf("load export: %w", err)
+	}
+
+	client := NewDiscordClient(resolvedToken)
+	added, err := syncExport(ctx, client, export, *quiet)
+	_, interrupted := interruptedBefore(err)
+	if err != nil && !interrupted {
+		return err
+	}
+
+	// Archives written with --extract-indicators keep their indicators
+	// current; extraction only runs for messages that have none yet.
+	if export.Indicators != nil {
+		if err := summarizeIndicators(export); err != nil {
+			return fmt.Errorf("extract indicators: %w", err)
+		}
+	}
+
+	dest := path
+	if *output != "" {
+		dest = ensureExtension(*output, ".json")
+	}
+	tmp := dest + ".tmp"
+	if err := writeJSON(tmp, export); err != nil {
+		return fmt.Errorf("write export: %w", err)
+	}
+	if err := os.Rename(filepath.Clean(tmp), filepath.Clean(dest)); err != nil {
+		return fmt.Errorf("write export: %w", err)
+	}
+	if _, err := finishOutputs(export, &runConfig{OutputPrefix: dest, SigningKey: signingKey}, []string{dest}); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+
+	if !*quiet {
+		fmt.Printf("added %d new messages to %s (%d total)\n", added, dest, export.MessageCount)
+	}
+	if interrupted {
+		return fmt.Errorf("%w; the archive holds everything fetched so far, rerun sync to continue", err)
+	}
+	return nil
+}
+
+// syncExport brings every channel in the export up to date and returns the
+// number of messages added. Thread messages are not re-synced; only each
+// channel's own history is followed forward. Because pages are fetched
+// oldest-first, an interrupted sync still leaves a gap-free archive; the
+// *interruptedError is returned after whatever was fetched has been merged.
+func syncExport(ctx context.Context, client *DiscordClient, export *Export, quiet bool) (int, error) {
+	added := 0
+	var syncErr error
+	if export.ChannelID != "" {
+		messages, stats, err := syncChannel(ctx, client, export.ChannelID, export.Messages, &export.Filters, quiet)
+		export.Stats.add(stats)
+		if err != nil && messages == nil {
+			return 0, err
+		}
+		syncErr = err
+		added = len(messages) - len(export.Messages)
+		export.Messages = messages
+		export.MessageCount = len(messages)
+	} else {
+		total := 0
+		for i := range export.Channels {
+			section := &export.Channels[i]
+			total += section.MessageCount
+			if syncErr != nil {
+				continue
+			}
+			messages, stats, err := syncChannel(ctx, client, section.ChannelID, section.Messages, &export.Filters, quiet)
+			section.Stats.add(stats)
+			export.Stats.add(stats)
+			if err != nil && messages == nil {
+				return 0, fmt.Errorf("channel %s: %w", section.ChannelID, err)
+			}
+			syncErr = err
+			added += len(messages) - len(section.Messages)
+			total += len(messages) - section.MessageCount
+			section.Messages = messages
+			section.MessageCount = len(messages)
+		}
+		export.MessageCount = total
+	}
+
+	export.ExportedAt = time.Now().UTC()
+	export.Filters.Until = nil
+	return added, syncErr
+}
+
+// syncChannel returns the merged messages for one channel. On interruption
+// it returns the merge of what was fetched along with the error; on any
+// other failure the messages are nil.
+func syncChannel(ctx context.Context, client *DiscordClient, channelID string, existing []Message, filters *FilterSummary, quiet bool) ([]Message, Stats, error) {
+	opts := scrapeOptions{ChannelID: channelID, Quiet: quiet}
+	applyContentFilters(&opts, filters)
+	var err error
+	if opts.filter, err = compileFilter(&opts); err != nil {
+		return nil, Stats{}, err
+	}
+	after := newestMessageID(existing, channelID)
+	if after == "" && filters.Since != nil {
+		after = snowflakeFromTime(*filters.Since)
+	}
+	fresh, stats, err := client.ScrapeAfter(ctx, &opts, after)
+	if _, ok := interruptedBefore(err); err != nil && !ok {
+		return nil, stats, err
+	}
+	return mergeMessages(existing, fresh), stats, err
+}
+
+// ScrapeAfter paginates forward from after (exclusive) to the newest message,
+// applying opts.filter. Results are in chronological order; on
+// cancellation the pages fetched so far are returned with an
+// *interruptedError.
+func (c *DiscordClient) ScrapeAfter(ctx context.Context, opts *scrapeOptions, after string) ([]Message, Stats, error) {
+	var results []Message
+	var stats Stats
+
+	for {
+		batch, metrics, err := c.fetchBatchAfter(ctx, opts.ChannelID, after, maxBatchSize)
+		stats.addMetrics(metrics)
+		if err != nil {
+			if errors.Is(err, errNoMoreMessages) {
+				break
+			}
+			if ctx.Err() != nil {
+				sortMessagesByID(results)
+				return results, stats, &interruptedError{cause: ctx.Err()}
+			}
+			return nil, stats, err
+		}
+
+		for i := range batch {
+			if snowflakeLess(after, batch[i].ID) {
+				after = batch[i].ID
+			}
+		}
+		results, _ = collectBatch(batch, results, opts)
+		if !opts.Quiet {
+			fmt.Printf("pulled %d new messages so far\n", len(results))
+		}
+		if len(batch) < maxBatchSize {
+			break
+		}
+	}
+
+	sortMessagesByID(results)
+	return results, stats, nil
+}
+
+// newestMessageID returns the highest message ID posted directly in the
+// channel, ignoring thread messages which live under other channel IDs.
+func newestMessageID(messages []Message, channelID string) string {
+	var newest string
+	for i := range messages {
+		if messages[i].ChannelID != channelID {
+			continue
+		}
+		if newest == "" || snowflakeLess(newest, messages[i].ID) {
+			newest = messages[i].ID
+		}
+	}
+	return newest
+}
+
+// mergeMessages appends fresh messages not already present and returns the
+// combined slice in chronological order.
+func mergeMessages(existing, fresh []Message) []Message {
+	seen := make(map[string]struct{}, len(existing))
+	for i := range existing {
+		seen[existing[i].ID] = struct{}{}
+	}
+	merged := existing
+	for i := range fresh {
+		if _, ok := seen[fresh[i].ID]; ok {
+			continue
+		}
+		seen[fresh[i].ID] = struct{}{}
+		merged = append(merged, fresh[i])
+	}
+	sortMessagesByID(merged)
+	return merged
+}
+
+func sortMessagesByID(messages []Message) {
+	sort.SliceStable(messages, func(i, j int) bool {
+		return snowflakeLess(messages[i].ID, messages[j].ID)
+	})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ScrapeChannelWithThreads scrapes a channel and, when opts.Threads is set,
+// every active and archived thread under it, spooling each into its own
+// stream of sp. Thread messages are tagged with their parent channel and
+// thread name as they are read back. The source is returned alongside an
+// *interruptedError when ctx is canceled.
+func (c *DiscordClient) ScrapeChannelWithThreads(ctx context.Context, opts *scrapeOptions, channel *apiChannel, sp *spool, own *spoolStream) (*spoolSource, Stats, error) {
+	if !opts.Threads {
+		count, stats, err := c.ScrapeChannel(ctx, opts, own)
+		return &spoolSource{own: own, count: count}, stats, err
+	}
+	return c.scrapeChannelTree(ctx, opts, channel, sp)
+}
+
+// fetchChannel looks up a channel record: its guild, type and name.
+func (c *DiscordClient) fetchChannel(ctx context.Context, channelID string) (apiChannel, batchMetrics, error) {
+	var channel apiChannel
+	endpoint := fmt.Sprintf("%s/channels/%s", apiBase, channelID)
+	metrics, err := c.getJSON(ctx, endpoint, nil, &channel)
+	return channel, metrics, err
+}
+
+// scrapeChannelTree is the shared body of ScrapeChannelWithThreads and the
+// guild sweep, which already has the channel record from the channel list.
+func (c *DiscordClient) scrapeChannelTree(ctx context.Context, opts *scrapeOptions, channel *apiChannel, sp *spool) (*spoolSource, Stats, error) {
+	src := &spoolSource{}
+	var stats Stats
+	interrupted := func(err error) (*spoolSource, Stats, error) {
+		if limitErr := src.limit(0); limitErr != nil {
+			return nil, stats, limitErr
+		}
+		return src, stats, err
+	}
+
+	if !isForumChannel(channel.Type) {
+		src.own = sp.newStream()
+		_, chStats, err := c.ScrapeChannel(ctx, opts, src.own)
+		stats.add(chStats)
+		if err != nil {
+			if _, ok := interruptedBefore(err); ok {
+				return interrupted(err)
+			}
+			return nil, stats, err
+		}
+	}
+
+	threads, metrics, err := c.listThreads(ctx, channel, opts.Since)
+	stats.addMetrics(metrics)
+	if err != nil {
+		if ctx.Err() != nil {
+			return interrupted(&interruptedError{cause: ctx.Err()})
+		}
+		return nil, stats, fmt.Errorf("list threads: %w", err)
+	}
+
+	for i := range threads {
+		thread := &threads[i]
+		if !opts.Quiet {
+			fmt.Printf("scraping thread %q (%s)\n", thread.Name, thread.ID)
+		}
+		threadOpts := *opts
+		threadOpts.ChannelID = thread.ID
+		stream := sp.newStream()
+		_, threadStats, err := c.ScrapeChannel(ctx, &threadOpts, stream)
+		stats.add(threadStats)
+		_, wasInterrupted := interruptedBefore(err)
+		if err != nil && !wasInterrupted {
+			if isAccessDenied(err) {
+				continue
+			}
+			return nil, stats, fmt.Errorf("thread %s: %w", thread.ID, err)
+		}
+		src.threads = append(src.threads, threadStream{stream: stream, parentID: channel.ID, name: thread.Name})
+		if wasInterrupted {
+			return interrupted(err)
+		}
+	}
+
+	if err := src.limit(opts.MaxMessages); err != nil {
+		return nil, stats, err
+	}
+	return src, stats, nil
+}
+
+// listThreads returns the channel's active threads plus its public and
+// private archived threads. Private archives need MANAGE_THREADS, so a 403
+// there is tolerated rather than failing the scrape.
+func (c *DiscordClient) listThreads(ctx context.Context, channel *apiChannel, since *time.Time) ([]apiChannel, batchMetrics, error) {
+	var metrics batchMetrics
+	var threads []apiChannel
+	seen := make(map[string]struct{})
+	add := func(list []apiChannel) {
+		for i := range list {
+			if list[i].ParentID != channel.ID {
+				continue
+			}
+			if _, ok := seen[list[i].ID]; ok {
+				continue
+			}
+			seen[list[i].ID] = struct{}{}
+			threads = append(threads, list[i])
+		}
+	}
+
+	if channel.GuildID != "" {
+		var active apiThreadList
+		endpoint := fmt.Sprintf("%s/guilds/%s/threads/active", apiBase, channel.GuildID)
+		m, err := c.getJSON(ctx, endpoint, nil, &active)
+		metrics.add(m)
+		if err != nil {
+			return nil, metrics, err
+		}
+		add(active.Threads)
+	}
+
+	for _, kind := range []string{"public", "private"} {
+		archived, m, err := c.listArchivedThreads(ctx, channel.ID, kind, since)
+		metrics.add(m)
+		if err != nil {
+			if kind == "private" && isAccessDenied(err) {
+				continue
+			}
+			return nil, metrics, err
+		}
+		add(archived)
+	}
+
+	return threads, metrics, nil
+}
+
+// listArchivedThreads pages through archived threads newest-first, stopping
+// once threads were archived before since (they cannot hold newer messages).
+func (c *DiscordClient) listArchivedThreads(ctx context.Context, channelID, kind string, since *time.Time) ([]apiChannel, batchMetrics, error) {
+	var metrics batchMetrics
+	var threads []apiChannel
+	endpoint := fmt.Sprintf("%s/channels/%s/threads/archived/%s", apiBase, channelID, kind)
+	var before string
+
+	for {
+		params := url.Values{}
+		params.Set("limit", strconv.Itoa(maxBatchSize))
+		if before != "" {
+			params.Set("before", before)
+		}
+
+		var page apiThreadList
+		m, err := c.getJSON(ctx, endpoint, params, &page)
+		metrics.add(m)
+		if err != nil {
+			return nil, metrics, err
+		}
+
+		for i := range page.Threads {
+			thread := &page.Threads[i]
+			if thread.ThreadMetadata == nil {
+				continue
+			}
+			before = thread.ThreadMetadata.ArchiveTimestamp
+			if archivedAt, ok := parseMessageTime(before); ok && since != nil && archivedAt.Before(since.UTC()) {
+				return threads, metrics, nil
+			}
+			threads = append(threads, *thread)
+		}
+
+		if !page.HasMore || len(page.Threads) == 0 || before == "" {
+			return threads, metrics, nil
+		}
+	}
+}
+
+func isForumChannel(channelType int) bool {
+	return channelType == channelTypeGuildForum || channelType == channelTypeGuildMedia
+}
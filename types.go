@@ -1,35 +1,122 @@
 package main
 
-import (
-	"encoding/json"
-	"time"
-)
+import "time"
 
+// Export is the document written for a run. Partial is set when the run was
+// interrupted, with StoppedBefore naming the message ID pagination would have
+// continued from.
 type Export struct {
-	ChannelID    string        `json:"channel_id"`
-	ExportedAt   time.Time     `json:"exported_at"`
-	MessageCount int           `json:"message_count"`
-	Messages     []Message     `json:"messages"`
-	Filters      FilterSummary `json:"filters"`
-	Stats        Stats         `json:"stats"`
+	GuildID       string           `json:"guild_id,omitempty"`
+	ChannelID     string           `json:"channel_id,omitempty"`
+	ExportedAt    time.Time        `json:"exported_at"`
+	MessageCount  int              `json:"message_count"`
+	Partial       bool             `json:"partial,omitempty"`
+	StoppedBefore string           `json:"stopped_before,omitempty"`
+	Messages      []Message        `json:"messages,omitempty"`
+	Channels      []ChannelExport  `json:"channels,omitempty"`
+	Skipped       []SkippedChannel `json:"skipped_channels,omitempty"`
+	Filters       FilterSummary    `json:"filters"`
+	Stats         Stats            `json:"stats"`
+	// Indicators is filled in by --extract-indicators; an empty list means
+	// extraction ran and found nothing.
+	Indicators []IndicatorSummary `json:"indicators,omitempty"`
+
+	// source holds spooled messages for live scrapes, leaving Messages nil.
+	source messageSource
+}
+
+// ChannelExport is one channel's section of a guild-wide export.
+type ChannelExport struct {
+	ChannelID     string    `json:"channel_id"`
+	GuildID       string    `json:"guild_id,omitempty"`
+	Name          string    `json:"name"`
+	MessageCount  int       `json:"message_count"`
+	Partial       bool      `json:"partial,omitempty"`
+	StoppedBefore string    `json:"stopped_before,omitempty"`
+	Messages      []Message `json:"messages"`
+	Stats         Stats     `json:"stats"`
+
+	source messageSource
+}
+
+type SkippedChannel struct {
+	ChannelID string `json:"channel_id"`
+	Name      string `json:"name"`
+	Reason    string `json:"reason"`
+}
+
+// ExportIndex is the manifest written next to per-channel files when a
+// multi-channel or guild run uses --split.
+type ExportIndex struct {
+	GuildID    string             `json:"guild_id,omitempty"`
+	ExportedAt time.Time          `json:"exported_at"`
+	Partial    bool               `json:"partial,omitempty"`
+	Channels   []ExportIndexEntry `json:"channels"`
+	Skipped    []SkippedChannel   `json:"skipped_channels,omitempty"`
+	Filters    FilterSummary      `json:"filters"`
+	Stats      Stats              `json:"stats"`
+}
+
+type ExportIndexEntry struct {
+	ChannelID     string   `json:"channel_id"`
+	Name          string   `json:"name"`
+	MessageCount  int      `json:"message_count"`
+	Partial       bool     `json:"partial,omitempty"`
+	StoppedBefore string   `json:"stopped_before,omitempty"`
+	Files         []string `json:"files"`
 }
 
+// FilterSummary records the filters a run applied. Regexes are kept as
+// written; keyword and user lists (including exclusions) are lower-cased.
 type FilterSummary struct {
-	Since    *time.Time `json:"since,omitempty"`
-	Until    *time.Time `json:"until,omitempty"`
-	Keywords []string   `json:"keywords,omitempty"`
-	Limit    int        `json:"limit,omitempty"`
-	Users    []string   `json:"users,omitempty"`
+	Since           *time.Time `json:"since,omitempty"`
+	Until           *time.Time `json:"until,omitempty"`
+	Keywords        []string   `json:"keywords,omitempty"`
+	Limit           int        `json:"limit,omitempty"`
+	Users           []string   `json:"users,omitempty"`
+	Query           string     `json:"query,omitempty"`
+	Regexes         []string   `json:"regex,omitempty"`
+	ExcludeKeywords []string   `json:"exclude_keywords,omitempty"`
+	ExcludeUsers    []string   `json:"exclude_users,omitempty"`
+	Bots            string     `json:"bots,omitempty"`
+	Types           []string   `json:"types,omitempty"`
 }
 
 type Stats struct {
 	Requests      int `json:"api_requests"`
 	RateLimitHits int `json:"rate_limit_hits"`
+	// ProactiveWaits counts pauses taken because a bucket's headers said it
+	// was exhausted; RateLimitHits counts the 429s that still got through.
+	// RateLimitSleepMS is the total time spent in either kind of wait.
+	ProactiveWaits   int   `json:"proactive_waits"`
+	RateLimitSleepMS int64 `json:"rate_limit_sleep_ms"`
+	// SeekCursor is the snowflake pagination started from when --range let
+	// the scrape skip straight to Until; RequestsSaved estimates the pages
+	// that seek avoided.
+	SeekCursor    string `json:"seek_cursor,omitempty"`
+	RequestsSaved int    `json:"requests_saved,omitempty"`
+}
+
+func (s *Stats) add(other Stats) {
+	s.Requests += other.Requests
+	s.RateLimitHits += other.RateLimitHits
+	s.ProactiveWaits += other.ProactiveWaits
+	s.RateLimitSleepMS += other.RateLimitSleepMS
+	s.RequestsSaved += other.RequestsSaved
+}
+
+func (s *Stats) addMetrics(m batchMetrics) {
+	s.Requests += m.requests
+	s.RateLimitHits += m.rateLimitHits
+	s.ProactiveWaits += m.proactiveWaits
+	s.RateLimitSleepMS += m.slept.Milliseconds()
 }
 
 type Message struct {
 	ID              string          `json:"id"`
 	ChannelID       string          `json:"channel_id"`
+	ParentChannelID string          `json:"parent_channel_id,omitempty"`
+	ThreadName      string          `json:"thread_name,omitempty"`
 	Author          Author          `json:"author"`
 	Content         string          `json:"content"`
 	Timestamp       time.Time       `json:"timestamp"`
@@ -41,13 +128,18 @@ type Message struct {
 	ReplyTo         *ReplyReference `json:"reply_to,omitempty"`
 	Type            int             `json:"type"`
 	EmbedCount      int             `json:"embed_count,omitempty"`
+	Embeds          []Embed         `json:"embeds,omitempty"`
+	Indicators      []Indicator     `json:"indicators,omitempty"`
 }
 
 type Author struct {
 	ID          string `json:"id"`
 	Username    string `json:"username"`
 	DisplayName string `json:"display_name,omitempty"`
-	Bot         bool   `json:"bot"`
+	// Bot marks bot accounts; Webhook marks messages posted through a
+	// webhook, which Discord also flags as bots.
+	Bot     bool `json:"bot"`
+	Webhook bool `json:"webhook,omitempty"`
 }
 
 type Attachment struct {
@@ -56,6 +148,13 @@ type Attachment struct {
 	URL         string `json:"url"`
 	ContentType string `json:"content_type,omitempty"`
 	Size        int64  `json:"size_bytes,omitempty"`
+	// LocalPath (relative to the export file), SHA256 and DownloadedBytes
+	// are filled in by --download-attachments; DownloadError says why a
+	// copy could not be saved.
+	LocalPath       string `json:"local_path,omitempty"`
+	SHA256          string `json:"sha256,omitempty"`
+	DownloadedBytes int64  `json:"downloaded_bytes,omitempty"`
+	DownloadError   string `json:"download_error,omitempty"`
 }
 
 type Reaction struct {
@@ -63,25 +162,51 @@ type Reaction struct {
 	Count int    `json:"count"`
 }
 
+// Embed is a link preview or rich embed as Discord renders it. Nested API
+// objects (author, footer, media) are flattened to the fields worth keeping.
+type Embed struct {
+	Type         string       `json:"type,omitempty"`
+	Title        string       `json:"title,omitempty"`
+	Description  string       `json:"description,omitempty"`
+	URL          string       `json:"url,omitempty"`
+	Timestamp    string       `json:"timestamp,omitempty"`
+	Color        int          `json:"color,omitempty"`
+	AuthorName   string       `json:"author_name,omitempty"`
+	AuthorURL    string       `json:"author_url,omitempty"`
+	ProviderName string       `json:"provider_name,omitempty"`
+	Footer       string       `json:"footer,omitempty"`
+	ImageURL     string       `json:"image_url,omitempty"`
+	ThumbnailURL string       `json:"thumbnail_url,omitempty"`
+	VideoURL     string       `json:"video_url,omitempty"`
+	Fields       []EmbedField `json:"fields,omitempty"`
+}
+
+type EmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
 type ReplyReference struct {
 	MessageID string `json:"message_id"`
 	AuthorID  string `json:"author_id,omitempty"`
 }
 
 type apiMessage struct {
-	ID                string            `json:"id"`
-	ChannelID         string            `json:"channel_id"`
-	Content           string            `json:"content"`
-	Timestamp         string            `json:"timestamp"`
-	EditedTimestamp   *string           `json:"edited_timestamp"`
-	Author            apiAuthor         `json:"author"`
-	Mentions          []apiUser         `json:"mentions"`
-	MentionRoles      []string          `json:"mention_roles"`
-	Attachments       []apiAttachment   `json:"attachments"`
-	Reactions         []apiReaction     `json:"reactions"`
-	Embeds            []json.RawMessage `json:"embeds"`
-	Type              int               `json:"type"`
-	ReferencedMessage *apiRefMessage    `json:"referenced_message"`
+	ID                string          `json:"id"`
+	ChannelID         string          `json:"channel_id"`
+	Content           string          `json:"content"`
+	Timestamp         string          `json:"timestamp"`
+	EditedTimestamp   *string         `json:"edited_timestamp"`
+	Author            apiAuthor       `json:"author"`
+	Mentions          []apiUser       `json:"mentions"`
+	MentionRoles      []string        `json:"mention_roles"`
+	Attachments       []apiAttachment `json:"attachments"`
+	Reactions         []apiReaction   `json:"reactions"`
+	Embeds            []apiEmbed      `json:"embeds"`
+	Type              int             `json:"type"`
+	ReferencedMessage *apiRefMessage  `json:"referenced_message"`
+	WebhookID         string          `json:"webhook_id"`
 }
 
 type apiAuthor struct {
@@ -106,6 +231,35 @@ type apiAttachment struct {
 	Size        int64  `json:"size"`
 }
 
+type apiEmbed struct {
+	Type        string         `json:"type"`
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	URL         string         `json:"url"`
+	Timestamp   string         `json:"timestamp"`
+	Color       int            `json:"color"`
+	Author      *apiEmbedName  `json:"author"`
+	Provider    *apiEmbedName  `json:"provider"`
+	Footer      *apiEmbedText  `json:"footer"`
+	Image       *apiEmbedMedia `json:"image"`
+	Thumbnail   *apiEmbedMedia `json:"thumbnail"`
+	Video       *apiEmbedMedia `json:"video"`
+	Fields      []EmbedField   `json:"fields"`
+}
+
+type apiEmbedName struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type apiEmbedText struct {
+	Text string `json:"text"`
+}
+
+type apiEmbedMedia struct {
+	URL string `json:"url"`
+}
+
 type apiReaction struct {
 	Count int      `json:"count"`
 	Emoji apiEmoji `json:"emoji"`
@@ -121,7 +275,36 @@ type apiRefMessage struct {
 	Author apiAuthor `json:"author"`
 }
 
+type apiChannel struct {
+	ID             string             `json:"id"`
+	GuildID        string             `json:"guild_id"`
+	Type           int                `json:"type"`
+	Name           string             `json:"name"`
+	ParentID       string             `json:"parent_id"`
+	Position       int                `json:"position"`
+	ThreadMetadata *apiThreadMetadata `json:"thread_metadata"`
+}
+
+type apiThreadMetadata struct {
+	Archived         bool   `json:"archived"`
+	ArchiveTimestamp string `json:"archive_timestamp"`
+}
+
+type apiThreadList struct {
+	Threads []apiChannel `json:"threads"`
+	HasMore bool         `json:"has_more"`
+}
+
 type batchMetrics struct {
-	requests      int
-	rateLimitHits int
+	requests       int
+	rateLimitHits  int
+	proactiveWaits int
+	slept          time.Duration
+}
+
+func (m *batchMetrics) add(other batchMetrics) {
+	m.requests += other.requests
+	m.rateLimitHits += other.rateLimitHits
+	m.proactiveWaits += other.proactiveWaits
+	m.slept += other.slept
 }